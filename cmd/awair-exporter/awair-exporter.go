@@ -2,21 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"prometheus-awair-exporter/internal/access"
 	"prometheus-awair-exporter/internal/app_info"
+	"prometheus-awair-exporter/internal/config"
+	"prometheus-awair-exporter/internal/discovery"
 	"prometheus-awair-exporter/internal/exporter"
 
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -24,6 +33,12 @@ import (
 var (
 	app_name = "awair-exporter"
 	version  = "x.x.x"
+
+	probeRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "awair_exporter",
+		Name:      "probe_rejections_total",
+		Help:      "Number of probes refused because the target isn't allowed, by reason",
+	}, []string{"reason"})
 )
 
 func init() {
@@ -37,60 +52,608 @@ func newHealthCheckHandler() http.Handler {
 	})
 }
 
-func newProbeHandler() http.HandlerFunc {
+// scrapeTimeoutOffset is subtracted from Prometheus' scrape timeout so the
+// probe has time to write its response before Prometheus gives up on it.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// probeTimeout returns the timeout for a single probe: the configured default,
+// lowered to fit inside the scrape timeout Prometheus advertises via the
+// X-Prometheus-Scrape-Timeout-Seconds header.
+func probeTimeout(r *http.Request, defaultTimeout time.Duration) (time.Duration, error) {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return defaultTimeout, nil
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid X-Prometheus-Scrape-Timeout-Seconds %q", header)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+	if defaultTimeout > 0 && defaultTimeout < timeout {
+		return defaultTimeout, nil
+	}
+	return timeout, nil
+}
+
+// prober holds the configuration and state shared by every probe.
+type prober struct {
+	cfg       *config.Config
+	client    *http.Client
+	cache     *exporter.ConfigCache
+	rawFields *exporter.RawFields
+	poller    *exporter.Poller
+	access    *access.Policy
+	// restricted is used for targets which aren't configured, when there are
+	// access rules, so they're enforced on the addresses connected to.
+	restricted *http.Client
+	// proxyClient is used for URL targets which aren't configured, without
+	// the per-host connection limit, which every device behind a reverse
+	// proxy would share.
+	proxyClient *http.Client
+	// clients are used for targets with their own TLS settings or behind a
+	// reverse proxy, by name, so each device gets its own connection limit.
+	clients map[string]*http.Client
+	// devices are the discovered devices, shared by every prober.
+	devices    *discovery.Registry
+	discoverer *discovery.Discoverer
+	// identifying is held while the configured targets are asked for their
+	// device_uuid, and guards lastIdentify.
+	identifying  chan struct{}
+	lastIdentify time.Time
+}
+
+// minIdentifyInterval is how often lookups of unknown devices may ask the
+// configured targets for their device_uuid at most, so clients asking for
+// made-up device_uuids can't keep the exporter sending requests to devices.
+const minIdentifyInterval = 30 * time.Second
+
+func newProber(cfg *config.Config, client *http.Client) *prober {
+	p := &prober{
+		cfg:         cfg,
+		client:      client,
+		identifying: make(chan struct{}, 1),
+	}
+	if cfg.Probe.ConfigCacheTTL > 0 || modulesUseCache(cfg) {
+		p.cache = exporter.NewConfigCache(cfg.Probe.ConfigCacheTTL)
+	}
+	if cfg.Probe.RawFields.Enabled {
+		p.rawFields = exporter.NewRawFields(cfg.Probe.RawFields.Deny)
+	}
+	// The rules were validated along with the config, so can't be invalid.
+	p.access, _ = access.NewPolicy(cfg.Access.Allow, cfg.Access.Deny)
+	p.proxyClient = exporter.NewProxyHTTPClient(nil)
+	if len(cfg.Access.Allow) > 0 || len(cfg.Access.Deny) > 0 {
+		p.restricted = exporter.RestrictHTTPClient(client, p.access.CheckConn)
+		p.proxyClient = exporter.RestrictHTTPClient(p.proxyClient, p.access.CheckConn)
+	}
+	p.clients = map[string]*http.Client{}
+	for _, t := range cfg.Targets {
+		var tlsConfig *tls.Config
+		if t.HasTLS() {
+			var err error
+			tlsConfig, err = exporter.LoadTLSConfig(t.TLS.CAFile, t.TLS.InsecureSkipVerify)
+			if err != nil {
+				// The CA file changed since the config was validated.
+				log.Error().Err(err).Str("target", t.Name).Msg("Failed to load TLS config")
+				continue
+			}
+		} else if !isURL(t.Host) {
+			continue
+		}
+		p.clients[t.Name] = exporter.NewHTTPClientWithTLS(tlsConfig)
+	}
+	return p
+}
+
+// modulesUseCache reports whether any module caches device configs.
+func modulesUseCache(cfg *config.Config) bool {
+	for _, m := range cfg.Modules {
+		if m.ConfigCacheTTL != nil && *m.ConfigCacheTTL > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// exporterOptions returns the options shared by every exporter of this prober.
+func (p *prober) exporterOptions() []exporter.Option {
+	opts := []exporter.Option{
+		exporter.WithHTTPClient(p.client),
+		exporter.WithTimeout(p.cfg.Probe.Timeout),
+		exporter.WithReadingTimestamps(p.cfg.Probe.ReadingTimestamps),
+		exporter.WithRawFields(p.rawFields),
+		exporter.WithDeviceLabels(p.cfg.Probe.DeviceLabels),
+		exporter.WithDerivedMetrics(p.cfg.Probe.DerivedMetrics),
+		exporter.WithAQIStandards(aqiStandards(p.cfg.Probe.AQIStandards)...),
+	}
+	if p.devices != nil {
+		opts = append(opts, exporter.WithDeviceRegistry(p.devices))
+	}
+	if p.cfg.Probe.ConfigCacheTTL > 0 {
+		opts = append(opts, exporter.WithConfigCache(p.cache))
+	}
+	return opts
+}
+
+// moduleOptions returns the options applying m on top of exporterOptions.
+// legacyModuleWarning is done once the deprecated module alias was warned
+// about, so it isn't logged on every scrape.
+var legacyModuleWarning sync.Once
+
+// module returns the module called name, warning about the deprecated alias
+// of the default module.
+func (p *prober) module(name string) (*config.Module, bool) {
+	if p.cfg.IsLegacyModule(name) {
+		legacyModuleWarning.Do(func() {
+			log.Warn().
+				Str("module", name).
+				Msgf("Module %q is deprecated and probes with the %q module, pass module=%s or none instead", name, config.DefaultModule, config.DefaultModule)
+		})
+	}
+	return p.cfg.Module(name)
+}
+
+func (p *prober) moduleOptions(m *config.Module) []exporter.Option {
+	// The module was validated along with the config, so can't be invalid.
+	units, _ := exporter.ParseUnitSystem(m.UnitSystem)
+	groups := make([]exporter.MetricGroup, 0, len(m.Metrics))
+	for _, name := range m.Metrics {
+		group, _ := exporter.ParseMetricGroup(name)
+		groups = append(groups, group)
+	}
+	opts := []exporter.Option{
+		exporter.WithMetricGroups(groups...),
+		exporter.WithUnitSystem(units),
+	}
+	if m.DerivedMetrics != nil {
+		opts = append(opts, exporter.WithDerivedMetrics(*m.DerivedMetrics))
+	}
+	if m.AQIStandards != nil {
+		opts = append(opts, exporter.WithAQIStandards(aqiStandards(m.AQIStandards)...))
+	}
+	if m.ConfigCacheTTL != nil {
+		opts = append(opts,
+			exporter.WithConfigCache(p.cache),
+			exporter.WithConfigCacheTTL(*m.ConfigCacheTTL),
+		)
+	}
+	return opts
+}
+
+// aqiStandards parses names, which were validated along with the config.
+func aqiStandards(names []string) []exporter.AQIStandard {
+	standards := make([]exporter.AQIStandard, 0, len(names))
+	for _, name := range names {
+		standard, _ := exporter.ParseAQIStandard(name)
+		standards = append(standards, standard)
+	}
+	return standards
+}
+
+// targetOptions returns the options for talking to the configured target t.
+func (p *prober) targetOptions(t *config.Target) []exporter.Option {
+	opts := []exporter.Option{exporter.WithDisplayName(t.DisplayName)}
+	if client, ok := p.clients[t.Name]; ok {
+		opts = append(opts, exporter.WithHTTPClient(client))
+	}
+	if t.BasicAuth != nil {
+		opts = append(opts, exporter.WithBasicAuth(t.BasicAuth.Username, t.BasicAuth.Password))
+	}
+	if t.BearerToken != "" {
+		opts = append(opts, exporter.WithBearerToken(t.BearerToken))
+	}
+	return opts
+}
+
+// startPolling polls every configured target with a poll interval.
+func (p *prober) startPolling(ctx context.Context) {
+	p.poller = nil
+	p.syncPolling(ctx)
+}
+
+// syncPolling makes the targets polled by the current poller match the
+// configured targets.
+func (p *prober) syncPolling(ctx context.Context) {
+	targets := map[string]exporter.PollTarget{}
+	for i, t := range p.cfg.Targets {
+		if t.PollInterval > 0 {
+			targets[t.Host] = exporter.PollTarget{
+				Interval: t.PollInterval,
+				Options:  p.targetOptions(&p.cfg.Targets[i]),
+			}
+		}
+	}
+	if p.poller == nil {
+		if len(targets) == 0 {
+			return
+		}
+		p.poller = exporter.NewPoller(p.exporterOptions()...)
+	}
+	p.poller.Sync(ctx, targets)
+}
+
+func (p *prober) stopPolling() {
+	if p.poller != nil {
+		p.poller.Stop()
+	}
+}
+
+// startDiscovery looks for devices with each enabled discovery mechanism,
+// registering them in p.devices.
+func (p *prober) startDiscovery(ctx context.Context) {
+	var finders []discovery.Finder
+	if m := p.cfg.Discovery.MDNS; m.Enabled {
+		f, err := discovery.NewMDNSFinder(m.Service, m.Domain, m.NamePattern, m.Timeout, m.Interface)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to start mDNS discovery")
+		} else {
+			finders = append(finders, f)
+		}
+	}
+	if sc := p.cfg.Discovery.Scan; len(sc.CIDRs) > 0 {
+		// The ranges were validated along with the config, so can't be invalid.
+		f, _ := discovery.NewScanFinder(sc.CIDRs, sc.Port, sc.Concurrency)
+		finders = append(finders, f)
+	}
+	if len(finders) == 0 {
+		return
+	}
+	p.discoverer = discovery.NewDiscoverer(p.devices, p.cfg.Discovery.Interval, finders,
+		discovery.WithAccessPolicy(p.access),
+		discovery.WithExporterOptions(
+			exporter.WithHTTPClient(p.client),
+			exporter.WithTimeout(p.cfg.Probe.Timeout),
+		),
+	)
+	p.discoverer.Start(ctx)
+}
+
+func (p *prober) stopDiscovery() {
+	if p.discoverer != nil {
+		p.discoverer.Stop()
+	}
+}
+
+// discovered returns the discovered device last found at host.
+func (p *prober) discovered(host string) (discovery.Device, bool) {
+	if p.devices == nil {
+		return discovery.Device{}, false
+	}
+	d, ok := p.devices.LookupHost(host)
+	return d, ok && d.Discovered()
+}
+
+// lookupDevice returns the device with the given device_uuid. When it isn't
+// known, the configured targets which haven't answered yet are asked for their
+// device_uuid, and discovery looks for the device.
+func (p *prober) lookupDevice(ctx context.Context, uuid string) (discovery.Device, bool) {
+	if p.devices == nil {
+		return discovery.Device{}, false
+	}
+	if d, ok := p.devices.Lookup(uuid); ok {
+		return d, true
+	}
+	p.identifyTargets(ctx)
+	if d, ok := p.devices.Lookup(uuid); ok {
+		return d, true
+	}
+	if p.discoverer != nil {
+		return p.discoverer.Lookup(ctx, uuid)
+	}
+	return discovery.Device{}, false
+}
+
+// identifyTargets registers the device of each configured target whose
+// device_uuid isn't known yet, unless targets were identified recently.
+// Concurrent calls share the requests.
+func (p *prober) identifyTargets(ctx context.Context) {
+	select {
+	case p.identifying <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-p.identifying }()
+	if time.Since(p.lastIdentify) < minIdentifyInterval {
+		return
+	}
+	p.lastIdentify = time.Now()
+
+	var wg sync.WaitGroup
+	for i, t := range p.cfg.Targets {
+		if _, ok := p.devices.UUIDOf(t.Host); ok {
+			continue
+		}
+		opts := append([]exporter.Option{
+			exporter.WithHTTPClient(p.client),
+			exporter.WithTimeout(p.cfg.Probe.Timeout),
+		}, p.targetOptions(&p.cfg.Targets[i])...)
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			config, err := exporter.FetchConfig(ctx, host, opts...)
+			if err != nil {
+				log.Debug().Err(err).Str("host", host).Msg("Failed to fetch config of configured target")
+				return
+			}
+			p.devices.Observe(host, config)
+		}(t.Host)
+	}
+	wg.Wait()
+}
+
+// resolve returns the host to probe for target, which is either a configured
+// target name or a host, the labels to attach to its series, and the options
+// for talking to it.
+func (p *prober) resolve(target string) (string, prometheus.Labels, []exporter.Option) {
+	if t, ok := p.cfg.Resolve(target); ok {
+		return t.Host, t.AllLabels(), p.targetOptions(t)
+	}
+	return target, nil, nil
+}
+
+// checkTarget returns an *access.RejectedError if target, probed at host,
+// may not be probed. Configured targets can always be probed, and discovered
+// ones count as configured.
+func (p *prober) checkTarget(ctx context.Context, target, host string) error {
+	if _, ok := p.cfg.Resolve(target); ok {
+		return nil
+	}
+	if _, ok := p.discovered(host); p.cfg.Access.ConfiguredTargetsOnly && !ok {
+		return &access.RejectedError{
+			Target: target,
+			Reason: access.ReasonNotConfigured,
+			Detail: "only configured targets may be probed",
+		}
+	}
+	return p.access.Check(ctx, host)
+}
+
+// adHocClient returns the client for host, a target which isn't configured,
+// or nil to use the shared client.
+func (p *prober) adHocClient(host string) *http.Client {
+	if isURL(host) {
+		return p.proxyClient
+	}
+	return p.restricted
+}
+
+// isURL reports whether host is the URL of a device behind a reverse proxy,
+// rather than a host.
+func isURL(host string) bool {
+	return strings.Contains(host, "://")
+}
+
+// registerer returns reg, wrapped to attach labels.
+func registerer(reg prometheus.Registerer, labels prometheus.Labels) prometheus.Registerer {
+	if len(labels) > 0 {
+		return prometheus.WrapRegistererWith(labels, reg)
+	}
+	return reg
+}
+
+func newProbeHandler(rl *reloader) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		p := rl.prober()
 		target := r.URL.Query().Get("target")
-		if target == "" {
-			http.Error(w, "Missing 'target' query parameter", http.StatusBadRequest)
+		uuid := r.URL.Query().Get("device_uuid")
+		if target == "" && uuid == "" {
+			http.Error(w, "Missing 'target' or 'device_uuid' query parameter", http.StatusBadRequest)
+			return
+		}
+		if target != "" && uuid != "" {
+			http.Error(w, "Only one of 'target' and 'device_uuid' may be given", http.StatusBadRequest)
+			return
+		}
+		moduleName := r.URL.Query().Get("module")
+		module, ok := p.module(moduleName)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
 			return
 		}
-		ex, err := exporter.NewAwairExporter(target)
+		defaultTimeout := p.cfg.Probe.Timeout
+		if module.Timeout > 0 {
+			defaultTimeout = module.Timeout
+		}
+		timeout, err := probeTimeout(r, defaultTimeout)
 		if err != nil {
-			http.Error(w, "Failed to connect to target: "+err.Error(), http.StatusBadGateway)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// One deadline bounds the whole probe, looking the device up
+		// included, so every request to a device shares the timeout rather
+		// than each getting its own.
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		if uuid != "" {
+			// Probe the device wherever it was last seen.
+			d, ok := p.lookupDevice(ctx, uuid)
+			if !ok {
+				http.Error(w, fmt.Sprintf("Unknown device %q", uuid), http.StatusNotFound)
+				return
+			}
+			target = d.Host
+		}
+		host, labels, targetOpts := p.resolve(target)
+		if err := p.checkTarget(ctx, target, host); err != nil {
+			var rejected *access.RejectedError
+			if errors.As(err, &rejected) {
+				probeRejections.WithLabelValues(rejected.Reason).Inc()
+			}
+			log.Warn().Err(err).
+				Str("remote_addr", r.RemoteAddr).
+				Msg("Refused to probe target")
+			http.Error(w, "Target not allowed: "+err.Error(), http.StatusForbidden)
 			return
 		}
+		if _, ok := p.cfg.Resolve(target); !ok {
+			if client := p.adHocClient(host); client != nil {
+				targetOpts = append(targetOpts, exporter.WithHTTPClient(client))
+			}
+		}
 		reg := prometheus.NewPedanticRegistry()
-		reg.MustRegister(ex)
+		if p.poller != nil {
+			if c, ok := p.poller.Collector(host, append(targetOpts, p.moduleOptions(module)...)...); ok {
+				registerer(reg, labels).MustRegister(c)
+				promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+				return
+			}
+		}
+		opts := append(p.exporterOptions(), targetOpts...)
+		opts = append(opts, p.moduleOptions(module)...)
+		opts = append(opts,
+			exporter.WithContext(ctx),
+			exporter.WithTimeout(timeout),
+		)
+		// Don't connect up front: an unreachable device is reported by
+		// awair_up 0 rather than by failing the probe.
+		ex := exporter.NewLazyAwairExporter(host, opts...)
+		registerer(reg, labels).MustRegister(ex)
 		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
 	}
 }
 
-func newMetricsHandler(hostname string, goCollector, processCollector bool) http.HandlerFunc {
+func newMetricsHandler(rl *reloader, hostname string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		p := rl.prober()
 		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(rl)
+		reg.MustRegister(probeRejections)
 		appFunc := app_info.AppInfoGaugeFunc(app_name, version, hostname)
 		reg.MustRegister(appFunc)
 
 		if hostname != "" {
 			// Backward compatible: exporter self-metrics + target metrics
-			ex, err := exporter.NewAwairExporter(hostname)
-			if err != nil {
-				http.Error(w, "Failed to connect to Awair device: "+err.Error(), http.StatusBadGateway)
-				return
-			}
-			reg.MustRegister(ex)
+			host, labels, targetOpts := p.resolve(hostname)
+			opts := append(p.exporterOptions(), targetOpts...)
+			opts = append(opts, exporter.WithContext(r.Context()))
+			ex := exporter.NewLazyAwairExporter(host, opts...)
+			registerer(reg, labels).MustRegister(ex)
+		}
+		if p.cache != nil {
+			reg.MustRegister(p.cache)
 		}
-		if goCollector {
+		if p.cfg.Collectors.Go {
 			reg.MustRegister(collectors.NewGoCollector())
 		}
-		if processCollector {
+		if p.cfg.Collectors.Process {
 			reg.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 		}
 		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
 	}
 }
 
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func main() {
+	configFile := flag.String("config.file", "", "path to a YAML config file, whose settings take precedence over flags")
 	debug := flag.Bool("debug", false, "sets log level to debug")
 	goCollector := flag.Bool("gocollector", false, "enables go stats exporter")
 	processCollector := flag.Bool("processcollector", false, "enables process stats exporter")
+	configCacheTTL := flag.Duration("probe.config-cache-ttl", exporter.DefaultConfigCacheTTL, "how long to reuse a device's config between scrapes, 0 disables the cache")
+	pollTargets := flag.String("poll.targets", "", "comma separated list of targets to poll in the background, /probe serves these from memory")
+	pollInterval := flag.Duration("poll.interval", exporter.DefaultPollInterval, "how often to poll each of -poll.targets")
+	deviceLabels := flag.Bool("probe.device-labels", false, "attach the device's device_uuid as a label to every metric")
+	aqiStandardNames := flag.String("probe.aqi-standards", "", "comma separated AQI standards to compute from PM2.5 and PM10: us_epa, us_epa_2012, eu_caqi and/or in_naqi")
+	derivedMetrics := flag.Bool("probe.derived-metrics", false, "export heat index, humidex, apparent temperature and vapor pressure deficit computed from the readings")
+	readingTimestamps := flag.Bool("probe.reading-timestamps", false, "attach the device's own reading timestamp to sensor metrics")
+	rawFieldsEnabled := flag.Bool("probe.raw-fields", false, "export unknown numeric fields of /air-data/latest as awair_raw{field=...}")
+	rawFieldsDeny := flag.String("probe.raw-fields-deny", "", "comma separated list of fields never exported by -probe.raw-fields")
+	configuredOnly := flag.Bool("probe.configured-targets-only", false, "only allow /probe to query targets from the config file or -poll.targets")
+	allow := flag.String("probe.allow", "", "comma separated CIDRs, IPs or hostname patterns /probe may query, all if empty")
+	deny := flag.String("probe.deny", "", "comma separated CIDRs, IPs or hostname patterns /probe must never query")
+	var listenAddresses stringList
+	flag.Var(&listenAddresses, "web.listen-address", "address to listen on, host:port or unix:<path>, repeatable (default :8080)")
+	routePrefix := flag.String("web.route-prefix", "", "prefix for every route, e.g. when served from a subpath by a reverse proxy")
+	telemetryPath := flag.String("web.telemetry-path", "/metrics", "path under which to expose the exporter's own metrics")
+	mdnsDiscovery := flag.Bool("discovery.mdns", false, "discover Awair devices on the local network with mDNS")
+	scanDiscovery := flag.String("discovery.scan", "", "comma separated CIDRs to scan for Awair devices, e.g. on networks without mDNS")
+	discoveryInterval := flag.Duration("discovery.interval", discovery.DefaultInterval, "how often to look for Awair devices")
+	webConfigFile := flag.String("web.config.file", "", "path to an exporter-toolkit web config file enabling TLS and/or basic auth")
+	timeout := flag.Duration("probe.timeout", exporter.DefaultTimeout, "default timeout for requests to an Awair device, lowered to fit the Prometheus scrape timeout")
 	flag.Parse()
 
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	base := config.Config{
+		Web: config.WebConfig{
+			ListenAddresses: config.StringList{":8080"},
+			RoutePrefix:     *routePrefix,
+			TelemetryPath:   *telemetryPath,
+		},
+		LogLevel: "info",
+		Collectors: config.CollectorsConfig{
+			Go:      *goCollector,
+			Process: *processCollector,
+		},
+		Probe: config.ProbeConfig{
+			Timeout:           *timeout,
+			ConfigCacheTTL:    *configCacheTTL,
+			ReadingTimestamps: *readingTimestamps,
+			DeviceLabels:      *deviceLabels,
+			DerivedMetrics:    *derivedMetrics,
+			AQIStandards:      splitList(*aqiStandardNames),
+			RawFields: config.RawFieldsConfig{
+				Enabled: *rawFieldsEnabled,
+				Deny:    splitList(*rawFieldsDeny),
+			},
+		},
+		Access: config.AccessConfig{
+			ConfiguredTargetsOnly: *configuredOnly,
+			Allow:                 splitList(*allow),
+			Deny:                  splitList(*deny),
+		},
+		Discovery: config.DiscoveryConfig{
+			Interval: *discoveryInterval,
+			MDNS: config.MDNSConfig{
+				Enabled:     *mdnsDiscovery,
+				Service:     discovery.DefaultMDNSService,
+				Domain:      discovery.DefaultMDNSDomain,
+				NamePattern: discovery.DefaultMDNSNamePattern,
+				Timeout:     discovery.DefaultMDNSTimeout,
+			},
+			Scan: config.ScanConfig{
+				CIDRs:       splitList(*scanDiscovery),
+				Port:        discovery.DefaultScanPort,
+				Concurrency: discovery.DefaultScanConcurrency,
+			},
+		},
+	}
+	if len(listenAddresses) > 0 {
+		base.Web.ListenAddresses = config.StringList(listenAddresses)
+	}
 	if *debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		base.LogLevel = "debug"
+	}
+	for _, target := range splitList(*pollTargets) {
+		base.Targets = append(base.Targets, config.Target{
+			Name:         target,
+			Host:         target,
+			PollInterval: *pollInterval,
+		})
+	}
+	cfg := &base
+	if *configFile != "" {
+		var err error
+		if cfg, err = config.Load(*configFile, base); err != nil {
+			log.Fatal().Err(err).Msg("Invalid config file")
+		}
+	} else if err := cfg.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid flags")
 	}
 
+	level, _ := zerolog.ParseLevel(cfg.LogLevel)
+	zerolog.SetGlobalLevel(level)
+
 	err := godotenv.Load(".env")
 	if err != nil {
 		log.Warn().Err(err).Msg("No .env file loaded")
@@ -106,7 +669,41 @@ func main() {
 		)
 	}
 
-	var srv http.Server
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	rl := newReloader(ctx, *configFile, base, cfg, exporter.NewHTTPClient())
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			log.Info().Msg("Reloading configuration in response to SIGHUP")
+			if err := rl.Reload(); err != nil {
+				log.Error().Err(err).Msg("Failed to reload configuration")
+			}
+		}
+	}()
+
+	log.Info().
+		Str("app_name", app_name).
+		Str("version", version).
+		Int("targets", len(cfg.Targets)).
+		Msg("Exporter Started.")
+
+	if *webConfigFile != "" {
+		if err := web.Validate(*webConfigFile); err != nil {
+			log.Fatal().Err(err).Msg("Invalid web config file")
+		}
+	}
+	listeners, err := listenAll(cfg.Web.ListenAddresses)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to start HTTP Server")
+	}
+	log.Info().
+		Strs("listen_address", cfg.Web.ListenAddresses).
+		Str("route_prefix", cfg.Web.RoutePrefix).
+		Msg("Listening.")
+	srv := newServers(newRouter(rl, hostname), listeners, *webConfigFile)
+
 	idleConnsClosed := make(chan struct{})
 	go func() {
 		sigchan := make(chan os.Signal, 1)
@@ -124,20 +721,8 @@ func main() {
 		close(idleConnsClosed)
 	}()
 
-	log.Info().
-		Str("app_name", app_name).
-		Str("version", version).
-		Msg("Exporter Started.")
-
-	router := http.NewServeMux()
-	router.Handle("/healthz", newHealthCheckHandler())
-	router.Handle("/probe", newProbeHandler())
-	router.Handle("/metrics", newMetricsHandler(hostname, *goCollector, *processCollector))
-
-	srv.Addr = ":8080"
-	srv.Handler = router
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatal().Err(err).Msg("Failed to start HTTP Server")
+	if err := srv.Serve(); err != nil {
+		log.Fatal().Err(err).Msg("HTTP Server failed")
 	}
 	<-idleConnsClosed
 }
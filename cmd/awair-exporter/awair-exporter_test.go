@@ -1,12 +1,63 @@
 package main
 
 import (
+	"context"
+	"encoding/pem"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"prometheus-awair-exporter/internal/access"
+	"prometheus-awair-exporter/internal/config"
+	"prometheus-awair-exporter/internal/discovery"
+	"prometheus-awair-exporter/internal/exporter"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
+// testConfig returns a config with the defaults main builds from flags.
+func testConfig() *config.Config {
+	return &config.Config{
+		Web: config.WebConfig{
+			ListenAddresses: config.StringList{":8080"},
+			TelemetryPath:   "/metrics",
+		},
+		LogLevel: "info",
+		Probe:    config.ProbeConfig{Timeout: time.Second},
+	}
+}
+
+// newTestReloader returns a reloader serving cfg, without a config file.
+func newTestReloader(t *testing.T, cfg *config.Config) *reloader {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return newReloader(ctx, "", *cfg, cfg, exporter.NewHTTPClient())
+}
+
+// testDevice returns a fake Awair device.
+func testDevice() *httptest.Server {
+	return testDeviceWithUUID("awair-element_1")
+}
+
+// testDeviceWithUUID returns a fake device reporting the given device_uuid.
+func testDeviceWithUUID(uuid string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			fmt.Fprintf(w, `{"device_uuid": %q, "fw_version": "1.1.4"}`, uuid)
+		case "/air-data/latest":
+			fmt.Fprint(w, `{"score": 89}`)
+		}
+	}))
+}
+
 func TestHealthzHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/healthz", nil)
 	rw := httptest.NewRecorder()
@@ -21,7 +72,7 @@ func TestHealthzHandler(t *testing.T) {
 }
 
 func TestMetricsHandler_NoHostname(t *testing.T) {
-	handler := newMetricsHandler("", false, false)
+	handler := newMetricsHandler(newTestReloader(t, testConfig()), "")
 	ts := httptest.NewServer(handler)
 	defer ts.Close()
 
@@ -36,8 +87,8 @@ func TestMetricsHandler_NoHostname(t *testing.T) {
 }
 
 func TestMetricsHandler_WithHostname(t *testing.T) {
-	// This will attempt to connect to the hostname, so we expect a 502 Bad Gateway
-	handler := newMetricsHandler("dummy-host", false, false)
+	// The hostname can't be reached, which is reported by awair_up 0.
+	handler := newMetricsHandler(newTestReloader(t, testConfig()), "dummy-host")
 	ts := httptest.NewServer(handler)
 	defer ts.Close()
 
@@ -46,13 +97,13 @@ func TestMetricsHandler_WithHostname(t *testing.T) {
 		t.Fatalf("/metrics request failed: %v", err)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusBadGateway && resp.StatusCode != http.StatusOK {
-		t.Errorf("/metrics returned %d, want 200 or 502", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/metrics returned %d, want 200", resp.StatusCode)
 	}
 }
 
 func TestProbeHandler_NoTarget(t *testing.T) {
-	handler := newProbeHandler()
+	handler := newProbeHandler(newTestReloader(t, testConfig()))
 	ts := httptest.NewServer(handler)
 	defer ts.Close()
 
@@ -67,7 +118,7 @@ func TestProbeHandler_NoTarget(t *testing.T) {
 }
 
 func TestProbeHandler_WithTarget(t *testing.T) {
-	handler := newProbeHandler()
+	handler := newProbeHandler(newTestReloader(t, testConfig()))
 	ts := httptest.NewServer(handler)
 	defer ts.Close()
 
@@ -76,7 +127,556 @@ func TestProbeHandler_WithTarget(t *testing.T) {
 		t.Fatalf("/probe request failed: %v", err)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusBadGateway && resp.StatusCode != http.StatusOK {
-		t.Errorf("/probe with dummy target returned %d, want 502 or 200", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/probe with dummy target returned %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	cases := []struct {
+		name      string
+		header    string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{"no_header", "", 10 * time.Second, false},
+		{"header_above_default", "15", 10 * time.Second, false},
+		{"header_below_default", "5", 4500 * time.Millisecond, false},
+		{"header_below_offset", "0.25", 250 * time.Millisecond, false},
+		{"header_invalid", "abc", 0, true},
+		{"header_negative", "-1", 0, true},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/probe?target=x", nil)
+			if cse.header != "" {
+				req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", cse.header)
+			}
+			got, err := probeTimeout(req, 10*time.Second)
+			if cse.expectErr {
+				if err == nil {
+					t.Errorf("probeTimeout() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("probeTimeout() returned error: %v", err)
+			}
+			if got != cse.expected {
+				t.Errorf("probeTimeout() = %v, want %v", got, cse.expected)
+			}
+		})
+	}
+}
+
+func TestProbeHandler_InvalidTimeoutHeader(t *testing.T) {
+	handler := newProbeHandler(newTestReloader(t, testConfig()))
+	req := httptest.NewRequest("GET", "/probe?target=dummy-host", nil)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "soon")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("/probe with invalid timeout header returned %d, want 400", rw.Code)
+	}
+}
+
+func TestMetricsHandler_ConfigCacheMetrics(t *testing.T) {
+	cfg := testConfig()
+	cfg.Probe.ConfigCacheTTL = time.Minute
+	handler := newMetricsHandler(newTestReloader(t, cfg), "")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+	for _, name := range []string{"awair_exporter_config_cache_hits_total", "awair_exporter_config_cache_misses_total"} {
+		if !strings.Contains(rw.Body.String(), name) {
+			t.Errorf("/metrics body missing %s", name)
+		}
+	}
+}
+
+func TestProbeHandler_PolledTarget(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	target := strings.TrimPrefix(device.URL, "http://")
+
+	cfg := testConfig()
+	cfg.Targets = []config.Target{{Name: "device", Host: target, PollInterval: time.Hour}}
+	handler := newProbeHandler(newTestReloader(t, cfg))
+	var body string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target="+target, nil))
+		body = rw.Body.String()
+		if strings.Contains(body, "awair_score 89") {
+			break
+		}
+	}
+	for _, want := range []string{"awair_score 89", "awair_data_age_seconds", "awair_last_success_timestamp_seconds"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/probe body missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	got := splitList(" a, b,,c ,")
+	want := []string{"a", "b", "c"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("splitList() = %q, want %q", got, want)
+	}
+	if got := splitList(""); len(got) != 0 {
+		t.Errorf("splitList(\"\") = %q, want empty", got)
+	}
+}
+
+func TestProbeHandler_TargetLabels(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	target := strings.TrimPrefix(device.URL, "http://")
+
+	cfg := testConfig()
+	cfg.Targets = []config.Target{{
+		Name:   "living-room",
+		Host:   target,
+		Labels: map[string]string{"room": "living", "floor": "1"},
+	}}
+	handler := newProbeHandler(newTestReloader(t, cfg))
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target="+target, nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("/probe returned %d, want 200", rw.Code)
+	}
+	if !strings.Contains(rw.Body.String(), `awair_score{floor="1",room="living"} 89`) {
+		t.Errorf("/probe body missing target labels:\n%s", rw.Body.String())
+	}
+}
+
+func TestProbeHandler_DeviceLabels(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	target := strings.TrimPrefix(device.URL, "http://")
+
+	cfg := testConfig()
+	cfg.Probe.DeviceLabels = true
+	cfg.Targets = []config.Target{{
+		Name:        "living-room",
+		Host:        target,
+		DisplayName: "Living Room",
+		Labels:      map[string]string{"room": "living"},
+	}}
+	handler := newProbeHandler(newTestReloader(t, cfg))
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target="+target, nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("/probe returned %d, want 200", rw.Code)
+	}
+	if !strings.Contains(rw.Body.String(), `awair_score{device_uuid="awair-element_1",display_name="Living Room",room="living"} 89`) {
+		t.Errorf("/probe body missing device labels:\n%s", rw.Body.String())
+	}
+}
+
+func TestProbeHandler_DeviceUUID(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	host := strings.TrimPrefix(device.URL, "http://")
+	configured := testDeviceWithUUID("awair-element_2")
+	defer configured.Close()
+
+	cfg := testConfig()
+	cfg.Access.ConfiguredTargetsOnly = true
+	cfg.Targets = []config.Target{{
+		Name:   "office",
+		Host:   strings.TrimPrefix(configured.URL, "http://"),
+		Labels: map[string]string{"room": "office"},
+	}}
+	rl := newTestReloader(t, cfg)
+	rl.devices.Update(discovery.Device{UUID: "awair-element_1", Host: host, Source: "mdns", LastSeen: time.Now()})
+	handler := newProbeHandler(rl)
+
+	cases := []struct {
+		name  string
+		query string
+		code  int
+		body  string
+	}{
+		{"discovered", "?device_uuid=awair-element_1", http.StatusOK, "awair_score 89"},
+		// Not probed yet, so asked for its device_uuid.
+		{"configured", "?device_uuid=awair-element_2", http.StatusOK, `awair_score{room="office"} 89`},
+		{"unknown", "?device_uuid=awair-element_3", http.StatusNotFound, `Unknown device "awair-element_3"`},
+		{"both", "?device_uuid=awair-element_1&target=office", http.StatusBadRequest, "Only one of"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe"+c.query, nil))
+			if rw.Code != c.code {
+				t.Fatalf("/probe%s returned %d, want %d:\n%s", c.query, rw.Code, c.code, rw.Body.String())
+			}
+			if !strings.Contains(rw.Body.String(), c.body) {
+				t.Errorf("/probe%s body missing %q:\n%s", c.query, c.body, rw.Body.String())
+			}
+		})
+	}
+}
+
+func TestProbeHandler_DeviceUUIDIdentifyRateLimit(t *testing.T) {
+	var requests atomic.Int32
+	offline := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer offline.Close()
+
+	cfg := testConfig()
+	cfg.Targets = []config.Target{{Name: "office", Host: strings.TrimPrefix(offline.URL, "http://")}}
+	rl := newTestReloader(t, cfg)
+	handler := newProbeHandler(rl)
+	probe := func() {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?device_uuid=bogus", nil))
+		if rw.Code != http.StatusNotFound {
+			t.Fatalf("/probe?device_uuid=bogus returned %d, want 404", rw.Code)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		probe()
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("configured target got %d requests, want 1", got)
+	}
+
+	rl.prober().lastIdentify = time.Now().Add(-minIdentifyInterval)
+	probe()
+	if got := requests.Load(); got != 2 {
+		t.Errorf("configured target got %d requests once the interval passed, want 2", got)
+	}
+}
+
+func TestProbeHandler_DeviceUUIDLookupDeadline(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(3 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	cfg := testConfig()
+	cfg.Probe.Timeout = time.Minute
+	cfg.Targets = []config.Target{{Name: "office", Host: strings.TrimPrefix(slow.URL, "http://")}}
+	handler := newProbeHandler(newTestReloader(t, cfg))
+	req := httptest.NewRequest("GET", "/probe?device_uuid=awair-element_1", nil)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "1")
+	rw := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("/probe returned %d, want 404", rw.Code)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("/probe took %v, want less than the 1s scrape timeout", elapsed)
+	}
+}
+
+func TestMetricsHandler_Collectors(t *testing.T) {
+	cfg := testConfig()
+	cfg.Collectors = config.CollectorsConfig{Go: true, Process: true}
+	handler := newMetricsHandler(newTestReloader(t, cfg), "")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+	for _, name := range []string{"go_goroutines", "process_start_time_seconds"} {
+		if !strings.Contains(rw.Body.String(), name) {
+			t.Errorf("/metrics body missing %s", name)
+		}
+	}
+}
+
+func TestProbeHandler_TargetAlias(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+
+	cfg := testConfig()
+	cfg.Targets = []config.Target{{
+		Name:     "living-room",
+		Host:     strings.TrimPrefix(device.URL, "http://"),
+		Room:     "living",
+		Floor:    "1",
+		Building: "hq",
+	}}
+	handler := newProbeHandler(newTestReloader(t, cfg))
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target=living-room", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("/probe?target=living-room returned %d, want 200", rw.Code)
+	}
+	if !strings.Contains(rw.Body.String(), `awair_score{building="hq",floor="1",room="living"} 89`) {
+		t.Errorf("/probe body missing location labels:\n%s", rw.Body.String())
+	}
+}
+
+func TestProbeHandler_Module(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			fmt.Fprint(w, `{"device_uuid": "awair-element_1", "fw_version": "1.1.4"}`)
+		case "/air-data/latest":
+			fmt.Fprint(w, `{"score": 89, "temp": 20, "humid": 50, "pm25": 35}`)
+		}
+	}))
+	defer device.Close()
+	target := strings.TrimPrefix(device.URL, "http://")
+
+	cfg := testConfig()
+	cfg.Probe.AQIStandards = []string{"us_epa"}
+	cfg.Probe.DerivedMetrics = true
+	off := false
+	cfg.Modules = map[string]config.Module{
+		"climate_us": {Metrics: []string{"sensors"}, UnitSystem: "imperial"},
+		"india":      {AQIStandards: []string{"in_naqi"}},
+		"no_aqi":     {AQIStandards: []string{}},
+		"no_derived": {DerivedMetrics: &off},
+	}
+	usAQI := `awair_aqi{pollutant="pm25",standard="us_epa"} 99`
+	handler := newProbeHandler(newTestReloader(t, cfg))
+
+	cases := []struct {
+		name    string
+		module  string
+		code    int
+		present []string
+		absent  []string
+	}{
+		{"no_module", "", http.StatusOK, []string{"awair_temp 20", "awair_device_info", usAQI}, nil},
+		{"default", "default", http.StatusOK, []string{"awair_temp 20", "awair_device_info", usAQI}, nil},
+		{"configured", "climate_us", http.StatusOK, []string{"awair_temp_fahrenheit 68", "awair_up 1", usAQI}, []string{"awair_device_info"}},
+		{"other_aqi", "india", http.StatusOK, []string{`awair_aqi{pollutant="pm25",standard="in_naqi"} 58`}, []string{usAQI}},
+		{"no_aqi", "no_aqi", http.StatusOK, []string{"awair_pm25 35"}, []string{"awair_aqi"}},
+		{"derived", "", http.StatusOK, []string{"awair_heat_index", "awair_vapor_pressure_deficit"}, nil},
+		{"no_derived", "no_derived", http.StatusOK, []string{"awair_temp 20"}, []string{"awair_heat_index", "awair_vapor_pressure_deficit"}},
+		{"legacy", "http_2xx", http.StatusOK, []string{"awair_temp 20", "awair_device_info", usAQI}, nil},
+		{"unknown", "icmp", http.StatusBadRequest, []string{`Unknown module "icmp"`}, nil},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target="+target+"&module="+cse.module, nil))
+			if rw.Code != cse.code {
+				t.Fatalf("/probe returned %d, want %d", rw.Code, cse.code)
+			}
+			for _, want := range cse.present {
+				if !strings.Contains(rw.Body.String(), want) {
+					t.Errorf("/probe body missing %q:\n%s", want, rw.Body.String())
+				}
+			}
+			for _, unwanted := range cse.absent {
+				if strings.Contains(rw.Body.String(), unwanted) {
+					t.Errorf("/probe body contains %q:\n%s", unwanted, rw.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestNewProber_ModuleCache(t *testing.T) {
+	cfg := testConfig()
+	if p := newProber(cfg, nil); p.cache != nil {
+		t.Errorf("newProber() created a config cache with caching disabled")
+	}
+	ttl := time.Minute
+	cfg.Modules = map[string]config.Module{"cached": {ConfigCacheTTL: &ttl}}
+	if p := newProber(cfg, nil); p.cache == nil {
+		t.Errorf("newProber() didn't create a config cache for a module using one")
+	}
+}
+
+func TestProbeHandler_Access(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	host := strings.TrimPrefix(device.URL, "http://")
+
+	office := []config.Target{{Name: "office", Host: host}}
+
+	cases := []struct {
+		name    string
+		access  config.AccessConfig
+		targets []config.Target
+		target  string
+		reason  string
+	}{
+		{"no_rules", config.AccessConfig{}, nil, host, ""},
+		{"allowed", config.AccessConfig{Allow: []string{"127.0.0.0/8"}}, nil, host, ""},
+		{"not_allowed", config.AccessConfig{Allow: []string{"10.0.0.0/8"}}, nil, host, access.ReasonNotAllowed},
+		{"denied", config.AccessConfig{Deny: []string{"127.0.0.1"}}, nil, host, access.ReasonDenied},
+		{"configured_only", config.AccessConfig{ConfiguredTargetsOnly: true}, nil, host, access.ReasonNotConfigured},
+		{"configured_only_by_name", config.AccessConfig{ConfiguredTargetsOnly: true}, office, "office", ""},
+		{"configured_only_by_host", config.AccessConfig{ConfiguredTargetsOnly: true}, office, host, ""},
+		{"configured_exempt_from_deny", config.AccessConfig{Deny: []string{"127.0.0.0/8"}}, office, "office", ""},
+		{"fragment_bypass", config.AccessConfig{Allow: []string{"*.iot.example.com"}}, nil, "169.254.169.254#.iot.example.com", access.ReasonInvalid},
+		{"query_bypass", config.AccessConfig{Allow: []string{"*.iot.example.com"}}, nil, "10.0.0.5?.iot.example.com", access.ReasonInvalid},
+		{"userinfo_bypass", config.AccessConfig{Allow: []string{"*.iot.example.com"}}, nil, "a.iot.example.com@" + host, access.ReasonInvalid},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Access = cse.access
+			cfg.Targets = cse.targets
+			handler := newProbeHandler(newTestReloader(t, cfg))
+
+			var before float64
+			if cse.reason != "" {
+				before = testutil.ToFloat64(probeRejections.WithLabelValues(cse.reason))
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target="+url.QueryEscape(cse.target), nil))
+			if cse.reason == "" {
+				if rw.Code != http.StatusOK {
+					t.Fatalf("/probe returned %d, want 200: %s", rw.Code, rw.Body.String())
+				}
+				return
+			}
+			if rw.Code != http.StatusForbidden {
+				t.Fatalf("/probe returned %d, want 403", rw.Code)
+			}
+			if got := testutil.ToFloat64(probeRejections.WithLabelValues(cse.reason)); got != before+1 {
+				t.Errorf("awair_exporter_probe_rejections_total{reason=%q} = %v, want %v", cse.reason, got, before+1)
+			}
+		})
+	}
+}
+
+func TestNewProber_ProxiedTargetClients(t *testing.T) {
+	cfg := testConfig()
+	cfg.Targets = []config.Target{
+		{Name: "office", Host: "https://proxy.example.com/awair/office"},
+		{Name: "warehouse", Host: "https://proxy.example.com/awair/warehouse"},
+		{Name: "kitchen", Host: "10.0.0.5"},
+	}
+	p := newProber(cfg, exporter.NewHTTPClient())
+
+	// Devices behind one proxy each get their own connection limit.
+	office, warehouse := p.clients["office"], p.clients["warehouse"]
+	if office == nil || warehouse == nil || office == warehouse {
+		t.Errorf("proxied targets share a client: office %p, warehouse %p", office, warehouse)
+	}
+	if _, ok := p.clients["kitchen"]; ok {
+		t.Errorf("kitchen has its own client, want the shared one")
+	}
+	if got := p.adHocClient("https://proxy.example.com/awair/lobby"); got != p.proxyClient {
+		t.Errorf("adHocClient() of a URL = %p, want the proxy client", got)
+	}
+	if got := p.adHocClient("10.0.0.6"); got != nil {
+		t.Errorf("adHocClient() of a host = %p, want the shared client", got)
+	}
+}
+
+func TestProbeHandler_HTTPSTarget(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	proxy := httptest.NewTLSServer(http.StripPrefix("/awair", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "prometheus" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		device.Config.Handler.ServeHTTP(w, r)
+	})))
+	defer proxy.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: proxy.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.Targets = []config.Target{{
+		Name:      "office",
+		Host:      proxy.URL + "/awair",
+		TLS:       config.TLSConfig{CAFile: caFile},
+		BasicAuth: &config.BasicAuth{Username: "prometheus", Password: "s3cret"},
+	}}
+	handler := newProbeHandler(newTestReloader(t, cfg))
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target=office", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("/probe returned %d, want 200: %s", rw.Code, rw.Body.String())
+	}
+	if !strings.Contains(rw.Body.String(), "awair_score 89") {
+		t.Errorf("/probe did not return the device's score:\n%s", rw.Body.String())
+	}
+}
+
+func TestProbeHandler_SingleDeadline(t *testing.T) {
+	// A device answering slowly for its config and not at all for its
+	// readings, so each request uses up most of any timeout it gets.
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay := time.Minute
+		if r.URL.Path == "/settings/config/data" {
+			delay = 700 * time.Millisecond
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprint(w, `{"device_uuid": "awair-element_1"}`)
+	}))
+	defer device.Close()
+
+	cfg := testConfig()
+	cfg.Probe.Timeout = time.Minute
+	handler := newProbeHandler(newTestReloader(t, cfg))
+	req := httptest.NewRequest("GET", "/probe?target="+strings.TrimPrefix(device.URL, "http://"), nil)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "1.5")
+	rw := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rw, req)
+	if elapsed := time.Since(start); elapsed >= 1500*time.Millisecond {
+		t.Errorf("/probe took %v, want less than the 1.5s scrape timeout", elapsed)
+	}
+}
+
+func TestProbeHandler_UnreachableTarget(t *testing.T) {
+	dead := testDevice()
+	deadHost := strings.TrimPrefix(dead.URL, "http://")
+	dead.Close()
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	cases := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{"dead", deadHost, []string{
+			"awair_up 0",
+			`awair_scrape_success{endpoint="config"} 0`,
+			`awair_scrape_success{endpoint="air-data"} 0`,
+			"awair_scrape_timeout 0",
+		}},
+		{"hung", strings.TrimPrefix(hung.URL, "http://"), []string{
+			"awair_up 0",
+			`awair_scrape_success{endpoint="config"} 0`,
+			"awair_scrape_timeout 1",
+		}},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			handler := newProbeHandler(newTestReloader(t, testConfig()))
+			req := httptest.NewRequest("GET", "/probe?target="+cse.target, nil)
+			req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "1")
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+			if rw.Code != http.StatusOK {
+				t.Fatalf("/probe returned %d, want 200: %s", rw.Code, rw.Body.String())
+			}
+			for _, want := range cse.want {
+				if !strings.Contains(rw.Body.String(), want) {
+					t.Errorf("/probe did not return %q:\n%s", want, rw.Body.String())
+				}
+			}
+		})
 	}
 }
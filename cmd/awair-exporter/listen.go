@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"prometheus-awair-exporter/internal/config"
+
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+// unixPrefix marks a listen address as the path of a unix socket.
+const unixPrefix = "unix:"
+
+// stringList is a flag which can be repeated, collecting every value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// listen opens a listener for addr, either a host:port pair or unix:<path>.
+// A stale unix socket left behind by a previous run is replaced.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// listenAll opens a listener for every address, closing those already opened
+// if any fails.
+func listenAll(addrs []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		l, err := listen(addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("listening on %s: %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// newRouter serves the exporter's routes under web.route_prefix.
+func newRouter(rl *reloader, hostname string) http.Handler {
+	web := rl.prober().cfg.Web
+	router := http.NewServeMux()
+	router.Handle(web.Path("/healthz"), newHealthCheckHandler())
+	router.Handle(web.Path("/probe"), newProbeHandler(rl))
+	router.Handle(web.Path("/sd"), newSDHandler(rl))
+	router.Handle(web.Path(web.TelemetryPath), newMetricsHandler(rl, hostname))
+	router.Handle(web.Path("/-/reload"), newReloadHandler(rl))
+	return router
+}
+
+// servers serves a handler on several listeners, applying the TLS and
+// authentication settings of an exporter-toolkit web config file. Each
+// listener has its own http.Server, as web.Serve wraps the server's handler.
+type servers struct {
+	listeners     []net.Listener
+	servers       []*http.Server
+	webConfigFile string
+	logger        *slog.Logger
+}
+
+func newServers(handler http.Handler, listeners []net.Listener, webConfigFile string) *servers {
+	s := &servers{
+		listeners:     listeners,
+		webConfigFile: webConfigFile,
+		logger:        newSlogLogger(),
+	}
+	for range listeners {
+		s.servers = append(s.servers, &http.Server{Handler: handler})
+	}
+	return s
+}
+
+// Serve serves every listener until the servers are shut down, returning the
+// first error other than http.ErrServerClosed.
+func (s *servers) Serve() error {
+	flags := &web.FlagConfig{WebConfigFile: &s.webConfigFile}
+	errs := make(chan error, len(s.listeners))
+	for i, l := range s.listeners {
+		go func(srv *http.Server, l net.Listener) {
+			errs <- web.Serve(l, srv, flags, s.logger)
+		}(s.servers[i], l)
+	}
+	var first error
+	for range s.listeners {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) && first == nil {
+			first = err
+			s.Close()
+		}
+	}
+	return first
+}
+
+// Shutdown gracefully shuts down every server.
+func (s *servers) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, srv := range s.servers {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Close immediately closes every server.
+func (s *servers) Close() {
+	for _, srv := range s.servers {
+		srv.Close()
+	}
+}
+
+// webSettingsChanged reports whether a reload changed a web setting which
+// only takes effect on restart.
+func webSettingsChanged(old, next config.WebConfig) bool {
+	return !slices.Equal(old.ListenAddresses, next.ListenAddresses) ||
+		old.RoutePrefix != next.RoutePrefix ||
+		old.TelemetryPath != next.TelemetryPath
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-awair-exporter/internal/config"
+)
+
+func TestStringList(t *testing.T) {
+	var l stringList
+	for _, v := range []string{":8080", "unix:/tmp/a.sock"} {
+		if err := l.Set(v); err != nil {
+			t.Fatalf("Set(%q) returned error: %v", v, err)
+		}
+	}
+	if got := l.String(); got != ":8080, unix:/tmp/a.sock" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+// get requests url with client, returning the status code.
+func get(t *testing.T, client *http.Client, url string) int {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestServe_MultipleListeners(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "exporter.sock")
+	addrs := []string{"127.0.0.1:0", "unix:" + socket}
+	if l, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		l.Close()
+		addrs = append(addrs, "[::1]:0")
+	}
+	listeners, err := listenAll(addrs)
+	if err != nil {
+		t.Fatalf("listenAll() returned error: %v", err)
+	}
+
+	srv := newServers(newRouter(newTestReloader(t, testConfig()), ""), listeners, "")
+	done := make(chan error)
+	go func() { done <- srv.Serve() }()
+
+	for _, l := range listeners {
+		client := http.DefaultClient
+		url := "http://" + l.Addr().String() + "/healthz"
+		if l.Addr().Network() == "unix" {
+			client = &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			}}
+			url = "http://unix/healthz"
+		}
+		if code := get(t, client, url); code != http.StatusOK {
+			t.Errorf("GET %s on %s returned %d, want 200", url, l.Addr(), code)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() returned error: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Serve() = %v, want nil after shutdown", err)
+	}
+}
+
+func TestListen_StaleSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "exporter.sock")
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("net.Listen() returned error: %v", err)
+	}
+	// Leave the socket file behind, as a crashed process would.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listen("unix:" + socket)
+	if err != nil {
+		t.Fatalf("listen() returned error: %v", err)
+	}
+	l.Close()
+}
+
+func TestListenAll_Error(t *testing.T) {
+	if _, err := listenAll([]string{"127.0.0.1:0", "256.0.0.1:0"}); err == nil || !strings.Contains(err.Error(), "256.0.0.1:0") {
+		t.Errorf("listenAll() = %v, want error naming the bad address", err)
+	}
+}
+
+func TestNewRouter_Paths(t *testing.T) {
+	cfg := testConfig()
+	cfg.Web.RoutePrefix = "/awair/"
+	cfg.Web.TelemetryPath = "/exporter-metrics"
+	router := newRouter(newTestReloader(t, cfg), "")
+
+	cases := []struct {
+		path string
+		code int
+	}{
+		{"/awair/healthz", http.StatusOK},
+		{"/awair/exporter-metrics", http.StatusOK},
+		{"/awair/probe", http.StatusBadRequest},
+		{"/awair/sd", http.StatusOK},
+		{"/awair/-/reload", http.StatusMethodNotAllowed},
+		{"/healthz", http.StatusNotFound},
+		{"/awair/metrics", http.StatusNotFound},
+	}
+	for _, cse := range cases {
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, httptest.NewRequest("GET", cse.path, nil))
+		if rw.Code != cse.code {
+			t.Errorf("GET %s returned %d, want %d", cse.path, rw.Code, cse.code)
+		}
+	}
+}
+
+func TestReload_KeepsWebSettings(t *testing.T) {
+	rl, path := newFileReloader(t, "web:\n  route_prefix: /awair\n")
+	writeConfig(t, path, "web:\n  listen_address: [':9000']\n  route_prefix: /other\n  telemetry_path: /self\n")
+	if err := rl.Reload(); err != nil {
+		t.Fatalf("Reload() returned error: %v", err)
+	}
+	web := rl.prober().cfg.Web
+	want := config.WebConfig{
+		ListenAddresses: config.StringList{":8080"},
+		RoutePrefix:     "/awair",
+		TelemetryPath:   "/metrics",
+	}
+	if webSettingsChanged(web, want) {
+		t.Errorf("Reload() changed web settings to %+v, want %+v", web, want)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"prometheus-awair-exporter/internal/config"
+	"prometheus-awair-exporter/internal/discovery"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// reloader owns the current prober, replacing it whenever the config file is
+// reloaded. Probes already in flight finish with the prober they started with.
+type reloader struct {
+	configFile string
+	base       config.Config
+	client     *http.Client
+	ctx        context.Context
+	devices    *discovery.Registry
+
+	mu      sync.Mutex
+	current atomic.Pointer[prober]
+
+	lastReloadSuccessful  prometheus.Gauge
+	lastReloadSuccessTime prometheus.Gauge
+}
+
+// newReloader returns a reloader serving cfg. configFile is re-read on each
+// reload, with base providing the settings missing from it. ctx bounds the
+// lifetime of background polling and discovery.
+func newReloader(ctx context.Context, configFile string, base config.Config, cfg *config.Config, client *http.Client) *reloader {
+	r := &reloader{
+		configFile: configFile,
+		base:       base,
+		client:     client,
+		ctx:        ctx,
+		devices:    discovery.NewRegistry(),
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "awair_exporter",
+			Name:      "config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful",
+		}),
+		lastReloadSuccessTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "awair_exporter",
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload",
+		}),
+	}
+	p := newProber(cfg, client)
+	p.devices = r.devices
+	p.startPolling(ctx)
+	p.startDiscovery(ctx)
+	r.current.Store(p)
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccessTime.SetToCurrentTime()
+	return r
+}
+
+func (r *reloader) prober() *prober {
+	return r.current.Load()
+}
+
+// Reload re-reads the config file and swaps in a prober using it. On error,
+// the current config is kept.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.configFile == "" {
+		r.lastReloadSuccessful.Set(0)
+		return fmt.Errorf("no config file to reload, start the exporter with -config.file")
+	}
+	cfg, err := config.Load(r.configFile, r.base)
+	if err != nil {
+		r.lastReloadSuccessful.Set(0)
+		return err
+	}
+
+	old := r.prober()
+	if webSettingsChanged(old.cfg.Web, cfg.Web) {
+		log.Warn().
+			Strs("listen_address", old.cfg.Web.ListenAddresses).
+			Str("route_prefix", old.cfg.Web.RoutePrefix).
+			Str("telemetry_path", old.cfg.Web.TelemetryPath).
+			Msg("web.listen_address, web.route_prefix and web.telemetry_path can't be changed by a reload, restart the exporter to apply them")
+		cfg.Web.ListenAddresses = old.cfg.Web.ListenAddresses
+		cfg.Web.RoutePrefix = old.cfg.Web.RoutePrefix
+		cfg.Web.TelemetryPath = old.cfg.Web.TelemetryPath
+	}
+	level, _ := zerolog.ParseLevel(cfg.LogLevel)
+	zerolog.SetGlobalLevel(level)
+
+	p := newProber(cfg, r.client)
+	p.devices = r.devices
+	restartDiscovery := !reflect.DeepEqual(cfg.Discovery, old.cfg.Discovery) ||
+		!reflect.DeepEqual(cfg.Access, old.cfg.Access) ||
+		cfg.Probe.Timeout != old.cfg.Probe.Timeout
+	if restartDiscovery {
+		old.stopDiscovery()
+		p.startDiscovery(r.ctx)
+	} else {
+		p.discoverer = old.discoverer
+	}
+	if reflect.DeepEqual(cfg.Probe, old.cfg.Probe) {
+		// Keep the cache and the polled readings.
+		p.rawFields, p.poller = old.rawFields, old.poller
+		if p.cache != nil && old.cache != nil {
+			p.cache = old.cache
+		}
+		if p.poller != nil {
+			// Restart polling targets whose connection settings changed.
+			for i, t := range cfg.Targets {
+				if prev, ok := old.cfg.TargetByHost(t.Host); ok && !sameConnection(prev, &cfg.Targets[i]) {
+					p.poller.Remove(t.Host)
+				}
+			}
+		}
+		p.syncPolling(r.ctx)
+		r.current.Store(p)
+	} else {
+		p.startPolling(r.ctx)
+		r.current.Store(p)
+		old.stopPolling()
+	}
+
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccessTime.SetToCurrentTime()
+	log.Info().
+		Str("config_file", r.configFile).
+		Int("targets", len(cfg.Targets)).
+		Msg("Configuration reloaded.")
+	return nil
+}
+
+// sameConnection reports whether a and b are reached in the same way.
+func sameConnection(a, b *config.Target) bool {
+	return a.TLS == b.TLS && a.BearerToken == b.BearerToken &&
+		reflect.DeepEqual(a.BasicAuth, b.BasicAuth)
+}
+
+func (r *reloader) Describe(ch chan<- *prometheus.Desc) {
+	r.lastReloadSuccessful.Describe(ch)
+	r.lastReloadSuccessTime.Describe(ch)
+}
+
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	r.lastReloadSuccessful.Collect(ch)
+	r.lastReloadSuccessTime.Collect(ch)
+}
+
+// reloadTokenHeader carries the reload token when the Authorization header is
+// taken by the basic auth of the web config file.
+const reloadTokenHeader = "X-Reload-Token"
+
+// newReloadHandler reloads the config on POST, if the request carries the
+// token configured in web.reload_token, as a bearer token or in the
+// X-Reload-Token header.
+func newReloadHandler(r *reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.prober().cfg.Web.ReloadToken
+		if token == "" {
+			http.Error(w, "Reloading via HTTP is disabled, set web.reload_token to enable it", http.StatusForbidden)
+			return
+		}
+		given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if header := req.Header.Get(reloadTokenHeader); header != "" {
+			given, ok = header, true
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := r.Reload(); err != nil {
+			log.Error().Err(err).Msg("Failed to reload configuration")
+			http.Error(w, "Failed to reload configuration: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "OK")
+	}
+}
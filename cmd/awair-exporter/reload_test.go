@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"prometheus-awair-exporter/internal/config"
+	"prometheus-awair-exporter/internal/exporter"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newFileReloader writes contents to a config file and returns a reloader
+// serving it.
+func newFileReloader(t *testing.T, contents string) (*reloader, string) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, contents)
+	cfg, err := config.Load(path, *testConfig())
+	if err != nil {
+		t.Fatalf("config.Load() returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return newReloader(ctx, path, *testConfig(), cfg, exporter.NewHTTPClient()), path
+}
+
+func writeConfig(t *testing.T, path, contents string) {
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	target := strings.TrimPrefix(device.URL, "http://")
+
+	rl, path := newFileReloader(t, "targets:\n  - name: a\n    host: "+target+"\n    labels:\n      room: kitchen\n")
+	handler := newProbeHandler(rl)
+	probe := func() string {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target="+target, nil))
+		return rw.Body.String()
+	}
+	if body := probe(); !strings.Contains(body, `awair_score{room="kitchen"} 89`) {
+		t.Fatalf("/probe body missing initial labels:\n%s", body)
+	}
+
+	writeConfig(t, path, "targets:\n  - name: a\n    host: "+target+"\n    labels:\n      room: office\n")
+	if err := rl.Reload(); err != nil {
+		t.Fatalf("Reload() returned error: %v", err)
+	}
+	if body := probe(); !strings.Contains(body, `awair_score{room="office"} 89`) {
+		t.Errorf("/probe body missing reloaded labels:\n%s", body)
+	}
+	if got := testutil.ToFloat64(rl.lastReloadSuccessful); got != 1 {
+		t.Errorf("config_last_reload_successful = %v, want 1", got)
+	}
+
+	writeConfig(t, path, "log_level: chatty\n")
+	if err := rl.Reload(); err == nil {
+		t.Errorf("Reload() of an invalid config returned no error")
+	}
+	if got := testutil.ToFloat64(rl.lastReloadSuccessful); got != 0 {
+		t.Errorf("config_last_reload_successful = %v, want 0", got)
+	}
+	if body := probe(); !strings.Contains(body, `awair_score{room="office"} 89`) {
+		t.Errorf("/probe after a failed reload lost the previous config:\n%s", body)
+	}
+}
+
+func TestReload_KeepsPolledReadings(t *testing.T) {
+	rl, path := newFileReloader(t, "targets:\n  - name: a\n    host: 127.0.0.1:1\n    poll_interval: 1h\n")
+	poller := rl.prober().poller
+	if poller == nil {
+		t.Fatal("target with poll_interval isn't polled")
+	}
+
+	writeConfig(t, path, "targets:\n  - name: a\n    host: 127.0.0.1:1\n    poll_interval: 1h\n    labels:\n      room: office\n")
+	if err := rl.Reload(); err != nil {
+		t.Fatalf("Reload() returned error: %v", err)
+	}
+	if rl.prober().poller != poller {
+		t.Errorf("Reload() replaced the poller although probe settings didn't change")
+	}
+
+	writeConfig(t, path, "probe:\n  timeout: 3s\ntargets:\n  - name: a\n    host: 127.0.0.1:1\n    poll_interval: 1h\n")
+	if err := rl.Reload(); err != nil {
+		t.Fatalf("Reload() returned error: %v", err)
+	}
+	if rl.prober().poller == poller {
+		t.Errorf("Reload() kept the poller although probe settings changed")
+	}
+}
+
+func TestReload_NoConfigFile(t *testing.T) {
+	rl := newTestReloader(t, testConfig())
+	if err := rl.Reload(); err == nil {
+		t.Errorf("Reload() without a config file returned no error")
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	rl, _ := newFileReloader(t, "web:\n  reload_token: s3cret\n")
+	disabled, _ := newFileReloader(t, "")
+
+	cases := []struct {
+		name     string
+		reloader *reloader
+		method   string
+		token    string
+		header   string
+		expected int
+	}{
+		{"get", rl, "GET", "s3cret", "", http.StatusMethodNotAllowed},
+		{"disabled", disabled, "POST", "s3cret", "", http.StatusForbidden},
+		{"no_token", rl, "POST", "", "", http.StatusUnauthorized},
+		{"wrong_token", rl, "POST", "guess", "", http.StatusUnauthorized},
+		{"ok", rl, "POST", "s3cret", "", http.StatusOK},
+		{"header_wrong_token", rl, "POST", "", "guess", http.StatusUnauthorized},
+		{"header_ok", rl, "POST", "", "s3cret", http.StatusOK},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			req := httptest.NewRequest(cse.method, "/-/reload", nil)
+			if cse.token != "" {
+				req.Header.Set("Authorization", "Bearer "+cse.token)
+			}
+			if cse.header != "" {
+				req.Header.Set(reloadTokenHeader, cse.header)
+			}
+			rw := httptest.NewRecorder()
+			newReloadHandler(cse.reloader).ServeHTTP(rw, req)
+			if rw.Code != cse.expected {
+				t.Errorf("/-/reload returned %d, want %d", rw.Code, cse.expected)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler_ReloadMetrics(t *testing.T) {
+	handler := newMetricsHandler(newTestReloader(t, testConfig()), "")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		"awair_exporter_config_last_reload_successful 1",
+		"awair_exporter_config_last_reload_success_timestamp_seconds",
+	} {
+		if !strings.Contains(rw.Body.String(), want) {
+			t.Errorf("/metrics body missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Sources of the targets listed by /sd, the value of __meta_awair_source.
+const (
+	sourceStatic     = "static"
+	sourceDiscovered = "discovered"
+	sourceCached     = "cached"
+)
+
+// sdTarget is a device listed by /sd.
+type sdTarget struct {
+	// target is the value of /probe's target parameter for the device. A
+	// discovered device has none, it's probed by its device_uuid instead, so
+	// Prometheus follows it when its address changes.
+	target string
+	// instance identifies the device's series, which for a discovered device
+	// is its device_uuid, as its address may change.
+	instance string
+	source   string
+	// name is the configured name of the target, if any.
+	name       string
+	host       string
+	deviceUUID string
+	// discoveredBy is the discovery mechanism which found the device, if any.
+	discoveredBy string
+	labels       map[string]string
+}
+
+// targetGroup is an entry of the Prometheus HTTP service discovery format.
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// knownTargets returns the configured targets, followed by the discovered
+// devices. With includeCached, it also returns any other target whose config
+// is cached because it answered its last probe within the cache TTL, and
+// which may still be probed.
+func (p *prober) knownTargets(ctx context.Context, includeCached bool) []sdTarget {
+	var cached map[string]string
+	if p.cache != nil {
+		cached = map[string]string{}
+		for host, config := range p.cache.Entries() {
+			cached[host] = config.DeviceUUID
+		}
+	}
+
+	var targets []sdTarget
+	for _, t := range p.cfg.Targets {
+		target := sdTarget{
+			target:     t.Name,
+			instance:   t.Name,
+			source:     sourceStatic,
+			name:       t.Name,
+			host:       t.Host,
+			deviceUUID: cached[t.Host],
+			labels:     t.AllLabels(),
+		}
+		if d, ok := p.discovered(t.Host); ok {
+			target.deviceUUID = d.UUID
+		}
+		targets = append(targets, target)
+		delete(cached, t.Host)
+	}
+
+	if p.devices != nil {
+		for _, d := range p.devices.Devices() {
+			if !d.Discovered() {
+				continue
+			}
+			if _, ok := p.cfg.TargetByHost(d.Host); ok {
+				continue
+			}
+			if latest, _ := p.devices.LookupHost(d.Host); latest.UUID != d.UUID {
+				// The address now belongs to another device.
+				continue
+			}
+			if err := p.checkTarget(ctx, d.Host, d.Host); err != nil {
+				continue
+			}
+			targets = append(targets, sdTarget{
+				instance:     d.UUID,
+				source:       sourceDiscovered,
+				host:         d.Host,
+				deviceUUID:   d.UUID,
+				discoveredBy: d.Source,
+			})
+			delete(cached, d.Host)
+		}
+	}
+
+	if !includeCached {
+		return targets
+	}
+	hosts := make([]string, 0, len(cached))
+	for host := range cached {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	for _, host := range hosts {
+		// The access rules may have been tightened by a reload since the
+		// target was probed.
+		if err := p.checkTarget(ctx, host, host); err != nil {
+			continue
+		}
+		targets = append(targets, sdTarget{
+			target:     host,
+			instance:   host,
+			source:     sourceCached,
+			host:       host,
+			deviceUUID: cached[host],
+		})
+	}
+	return targets
+}
+
+// newSDHandler serves every known target in the Prometheus HTTP service
+// discovery format, so a scrape config only needs an http_sd_configs entry
+// pointing at the exporter. Each target is scraped through the exporter's
+// /probe, with the address the request reached the exporter on.
+//
+// The target's labels are already attached to its series by /probe, so they
+// are only passed on as __meta_awair_label_<name>, which relabel_configs can
+// use; as target labels, Prometheus would rename the series' copies to
+// exported_<name>.
+func newSDHandler(rl *reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := rl.prober()
+		moduleName := r.URL.Query().Get("module")
+		if _, ok := p.module(moduleName); !ok {
+			http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+			return
+		}
+		// Anyone who can reach /probe can get a target cached, so listing
+		// them has to be asked for.
+		includeCached := r.URL.Query().Get("cached") == "true"
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		groups := []targetGroup{}
+		for _, t := range p.knownTargets(r.Context(), includeCached) {
+			labels := map[string]string{
+				"__metrics_path__":    p.cfg.Web.Path("/probe"),
+				"__scheme__":          scheme,
+				"instance":            t.instance,
+				"__meta_awair_source": t.source,
+				"__meta_awair_host":   t.host,
+			}
+			if t.target != "" {
+				labels["__param_target"] = t.target
+			} else {
+				labels["__param_device_uuid"] = t.deviceUUID
+			}
+			if moduleName != "" {
+				labels["__param_module"] = moduleName
+			}
+			if t.name != "" {
+				labels["__meta_awair_name"] = t.name
+			}
+			if t.deviceUUID != "" {
+				labels["__meta_awair_device_uuid"] = t.deviceUUID
+			}
+			if t.discoveredBy != "" {
+				labels["__meta_awair_discovery"] = t.discoveredBy
+			}
+			for name, value := range t.labels {
+				labels["__meta_awair_label_"+name] = value
+			}
+			groups = append(groups, targetGroup{
+				Targets: []string{r.Host},
+				Labels:  labels,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(groups); err != nil {
+			log.Error().Err(err).Msg("Failed to write service discovery response")
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-awair-exporter/internal/config"
+	"prometheus-awair-exporter/internal/discovery"
+)
+
+// getSD returns the target groups served by /sd, after probing each of probed.
+func getSD(t *testing.T, rl *reloader, query string, probed ...string) []targetGroup {
+	for _, target := range probed {
+		rw := httptest.NewRecorder()
+		newProbeHandler(rl).ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target="+target, nil))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("/probe?target=%s returned %d", target, rw.Code)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	newSDHandler(rl).ServeHTTP(rw, httptest.NewRequest("GET", "http://exporter:8080/sd"+query, nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("/sd returned %d: %s", rw.Code, rw.Body.String())
+	}
+	if ct := rw.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("/sd returned Content-Type %q, want application/json", ct)
+	}
+	var groups []targetGroup
+	if err := json.Unmarshal(rw.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("/sd returned invalid JSON: %v", err)
+	}
+	return groups
+}
+
+func TestSDHandler(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	adHoc := testDevice()
+	defer adHoc.Close()
+	host := strings.TrimPrefix(device.URL, "http://")
+	adHocHost := strings.TrimPrefix(adHoc.URL, "http://")
+
+	cfg := testConfig()
+	cfg.Web.RoutePrefix = "/awair"
+	cfg.Probe.ConfigCacheTTL = time.Hour
+	cfg.Targets = []config.Target{{
+		Name:   "office",
+		Host:   host,
+		Room:   "office",
+		Labels: map[string]string{"owner": "facilities"},
+	}}
+
+	got := getSD(t, newTestReloader(t, cfg), "?cached=true", "office", adHocHost)
+	want := []targetGroup{
+		{
+			Targets: []string{"exporter:8080"},
+			Labels: map[string]string{
+				"__metrics_path__":         "/awair/probe",
+				"__scheme__":               "http",
+				"__param_target":           "office",
+				"instance":                 "office",
+				"__meta_awair_source":      "static",
+				"__meta_awair_name":        "office",
+				"__meta_awair_host":        host,
+				"__meta_awair_device_uuid": "awair-element_1",
+				"__meta_awair_label_room":  "office",
+				"__meta_awair_label_owner": "facilities",
+			},
+		},
+		{
+			Targets: []string{"exporter:8080"},
+			Labels: map[string]string{
+				"__metrics_path__":         "/awair/probe",
+				"__scheme__":               "http",
+				"__param_target":           adHocHost,
+				"instance":                 adHocHost,
+				"__meta_awair_source":      "cached",
+				"__meta_awair_host":        adHocHost,
+				"__meta_awair_device_uuid": "awair-element_1",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("/sd returned\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestSDHandler_CachedTargets(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	host := strings.TrimPrefix(device.URL, "http://")
+
+	cfg := testConfig()
+	cfg.Probe.ConfigCacheTTL = 50 * time.Millisecond
+	rl := newTestReloader(t, cfg)
+
+	// Ad-hoc targets are only listed when asked for.
+	if got := getSD(t, rl, "", host); len(got) != 0 {
+		t.Errorf("/sd returned %+v, want no targets", got)
+	}
+	if got := getSD(t, rl, "?cached=true"); len(got) != 1 || got[0].Labels["__param_target"] != host {
+		t.Errorf("/sd?cached=true returned %+v, want %s", got, host)
+	}
+
+	// And only until their config expires.
+	time.Sleep(100 * time.Millisecond)
+	if got := getSD(t, rl, "?cached=true"); len(got) != 0 {
+		t.Errorf("/sd?cached=true returned %+v after the TTL, want no targets", got)
+	}
+}
+
+func TestSDHandler_Module(t *testing.T) {
+	cfg := testConfig()
+	cfg.Modules = map[string]config.Module{"climate": {}}
+	cfg.Targets = []config.Target{{Name: "office", Host: "192.168.0.4"}}
+
+	got := getSD(t, newTestReloader(t, cfg), "?module=climate")
+	if len(got) != 1 || got[0].Labels["__param_module"] != "climate" {
+		t.Errorf("/sd?module=climate returned %+v, want __param_module=climate", got)
+	}
+
+	rw := httptest.NewRecorder()
+	newSDHandler(newTestReloader(t, cfg)).ServeHTTP(rw, httptest.NewRequest("GET", "/sd?module=unknown", nil))
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("/sd?module=unknown returned %d, want 400", rw.Code)
+	}
+}
+
+func TestSDHandler_CachedTargetsFollowAccessRules(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	host := strings.TrimPrefix(device.URL, "http://")
+
+	cfg := testConfig()
+	cfg.Probe.ConfigCacheTTL = time.Hour
+	rl := newTestReloader(t, cfg)
+	rw := httptest.NewRecorder()
+	newProbeHandler(rl).ServeHTTP(rw, httptest.NewRequest("GET", "/probe?target="+host, nil))
+
+	// Only configured targets may be probed after a reload, which keeps the
+	// cache.
+	next := *cfg
+	next.Access.ConfiguredTargetsOnly = true
+	p := newProber(&next, rl.prober().client)
+	p.cache = rl.prober().cache
+	if got := p.knownTargets(t.Context(), true); len(got) != 0 {
+		t.Errorf("knownTargets() = %+v, want none", got)
+	}
+}
+
+func TestSDHandler_Discovered(t *testing.T) {
+	device := testDevice()
+	defer device.Close()
+	host := strings.TrimPrefix(device.URL, "http://")
+
+	cfg := testConfig()
+	cfg.Access.ConfiguredTargetsOnly = true
+	cfg.Targets = []config.Target{{Name: "office", Host: "192.168.0.4"}}
+	rl := newTestReloader(t, cfg)
+	now := time.Now()
+	rl.devices.Update(discovery.Device{UUID: "awair-element_2", Host: "192.168.0.4", Source: "mdns", LastSeen: now})
+	rl.devices.Update(discovery.Device{UUID: "awair-element_1", Host: host, Source: "mdns", LastSeen: now})
+	// A device which was at the same address before.
+	rl.devices.Update(discovery.Device{UUID: "awair-element_0", Host: host, Source: "mdns", LastSeen: now.Add(-time.Minute)})
+
+	// Discovered devices may be probed like configured ones.
+	got := getSD(t, rl, "", host)
+	want := []targetGroup{
+		{
+			Targets: []string{"exporter:8080"},
+			Labels: map[string]string{
+				"__metrics_path__":         "/probe",
+				"__scheme__":               "http",
+				"__param_target":           "office",
+				"instance":                 "office",
+				"__meta_awair_source":      "static",
+				"__meta_awair_name":        "office",
+				"__meta_awair_host":        "192.168.0.4",
+				"__meta_awair_device_uuid": "awair-element_2",
+			},
+		},
+		{
+			Targets: []string{"exporter:8080"},
+			Labels: map[string]string{
+				"__metrics_path__":         "/probe",
+				"__scheme__":               "http",
+				"__param_device_uuid":      "awair-element_1",
+				"instance":                 "awair-element_1",
+				"__meta_awair_source":      "discovered",
+				"__meta_awair_discovery":   "mdns",
+				"__meta_awair_host":        host,
+				"__meta_awair_device_uuid": "awair-element_1",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("/sd returned\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// zerologHandler is a slog.Handler writing to the global zerolog logger, for
+// libraries which log through slog.
+type zerologHandler struct {
+	// attrs have the group prefix of the handler they were added to.
+	attrs  []slog.Attr
+	prefix string
+}
+
+func newSlogLogger() *slog.Logger {
+	return slog.New(&zerologHandler{})
+}
+
+func zerologLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zerolog.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zerolog.WarnLevel
+	case level >= slog.LevelInfo:
+		return zerolog.InfoLevel
+	case level >= slog.LevelDebug:
+		return zerolog.DebugLevel
+	}
+	return zerolog.TraceLevel
+}
+
+func (h *zerologHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return zerologLevel(level) >= zerolog.GlobalLevel()
+}
+
+func (h *zerologHandler) Handle(_ context.Context, r slog.Record) error {
+	event := log.WithLevel(zerologLevel(r.Level))
+	for _, a := range h.attrs {
+		addAttr(event, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(event, h.prefix, a)
+		return true
+	})
+	event.Msg(r.Message)
+	return nil
+}
+
+// addAttr adds a to event, flattening groups into dotted keys.
+func addAttr(event *zerolog.Event, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, attr := range a.Value.Group() {
+			addAttr(event, prefix+a.Key+".", attr)
+		}
+		return
+	}
+	event.Interface(prefix+a.Key, a.Value.Any())
+}
+
+func (h *zerologHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &zerologHandler{prefix: h.prefix, attrs: append([]slog.Attr{}, h.attrs...)}
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		next.attrs = append(next.attrs, a)
+	}
+	return next
+}
+
+func (h *zerologHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &zerologHandler{prefix: h.prefix + name + ".", attrs: h.attrs}
+}
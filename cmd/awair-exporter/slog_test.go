@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = previous })
+
+	logger := newSlogLogger().With("component", "web").WithGroup("tls")
+	logger.Info("TLS is enabled.", "http2", true, "address", "[::]:8080")
+	logger.Debug("Not logged at info level.")
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("log output %q isn't a single JSON line: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"level":       "info",
+		"message":     "TLS is enabled.",
+		"component":   "web",
+		"tls.http2":   true,
+		"tls.address": "[::]:8080",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("log field %s = %v, want %v", key, got[key], value)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testCert is a certificate and key, written to PEM files.
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert issues a certificate for tmpl, signed by parent or self-signed
+// if parent is nil.
+func newTestCert(t *testing.T, name string, tmpl *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("generating serial: %v", err)
+	}
+	tmpl.SerialNumber = serial
+	tmpl.Subject = pkix.Name{CommonName: name}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+
+	dir := t.TempDir()
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	writePEM(t, c.certFile, "CERTIFICATE", der)
+	writePEM(t, c.keyFile, "EC PRIVATE KEY", keyDER)
+	return c
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+// testPKI returns a CA, and a server and client certificate it issued.
+func testPKI(t *testing.T) (ca, server, client *testCert) {
+	ca = newTestCert(t, "ca", &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	server = newTestCert(t, "server", &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	client = newTestCert(t, "client", &x509.Certificate{
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	return ca, server, client
+}
+
+// serveWithWebConfig serves the exporter with the given web config file
+// contents, returning its address.
+func serveWithWebConfig(t *testing.T, webConfig string) string {
+	return serveReloaderWithWebConfig(t, newTestReloader(t, testConfig()), webConfig)
+}
+
+// serveReloaderWithWebConfig is like serveWithWebConfig, serving rl's config.
+func serveReloaderWithWebConfig(t *testing.T, rl *reloader, webConfig string) string {
+	path := filepath.Join(t.TempDir(), "web.yml")
+	if err := os.WriteFile(path, []byte(webConfig), 0o600); err != nil {
+		t.Fatalf("writing web config: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() returned error: %v", err)
+	}
+	srv := newServers(newRouter(rl, ""), []net.Listener{l}, path)
+	done := make(chan error)
+	go func() { done <- srv.Serve() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+		if err := <-done; err != nil {
+			t.Errorf("Serve() returned error: %v", err)
+		}
+	})
+	return l.Addr().String()
+}
+
+// tlsClient returns a client trusting ca, presenting cert if it's set.
+func tlsClient(ca, cert *testCert) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: roots}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{{
+			Certificate: [][]byte{cert.cert.Raw},
+			PrivateKey:  cert.key,
+		}}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+func TestWebConfig_TLSAndBasicAuth(t *testing.T) {
+	ca, server, _ := testPKI(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword() returned error: %v", err)
+	}
+	addr := serveWithWebConfig(t, `
+tls_server_config:
+  cert_file: `+server.certFile+`
+  key_file: `+server.keyFile+`
+basic_auth_users:
+  prometheus: `+string(hash)+`
+`)
+	client := tlsClient(ca, nil)
+
+	cases := []struct {
+		name     string
+		user     string
+		password string
+		code     int
+	}{
+		{"no_credentials", "", "", http.StatusUnauthorized},
+		{"wrong_password", "prometheus", "guess", http.StatusUnauthorized},
+		{"unknown_user", "admin", "s3cret", http.StatusUnauthorized},
+		{"valid", "prometheus", "s3cret", http.StatusOK},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			for _, path := range []string{"/healthz", "/metrics"} {
+				req, _ := http.NewRequest("GET", "https://"+addr+path, nil)
+				if cse.user != "" {
+					req.SetBasicAuth(cse.user, cse.password)
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("GET %s failed: %v", path, err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != cse.code {
+					t.Errorf("GET %s returned %d, want %d", path, resp.StatusCode, cse.code)
+				}
+			}
+		})
+	}
+
+	if code := get(t, http.DefaultClient, "http://"+addr+"/healthz"); code == http.StatusOK {
+		t.Errorf("plain HTTP request to a TLS listener succeeded")
+	}
+}
+
+func TestWebConfig_BasicAuthAndReload(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword() returned error: %v", err)
+	}
+	rl, _ := newFileReloader(t, "web:\n  reload_token: t0ken\n")
+	addr := serveReloaderWithWebConfig(t, rl, "basic_auth_users:\n  prometheus: "+string(hash)+"\n")
+
+	cases := []struct {
+		name  string
+		basic bool
+		token string
+		code  int
+	}{
+		{"no_credentials", false, "t0ken", http.StatusUnauthorized},
+		{"no_token", true, "", http.StatusUnauthorized},
+		{"wrong_token", true, "guess", http.StatusUnauthorized},
+		{"valid", true, "t0ken", http.StatusOK},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "http://"+addr+"/-/reload", nil)
+			if cse.basic {
+				req.SetBasicAuth("prometheus", "s3cret")
+			}
+			if cse.token != "" {
+				req.Header.Set(reloadTokenHeader, cse.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("POST /-/reload failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != cse.code {
+				t.Errorf("POST /-/reload returned %d, want %d", resp.StatusCode, cse.code)
+			}
+		})
+	}
+}
+
+func TestWebConfig_MutualTLS(t *testing.T) {
+	ca, server, client := testPKI(t)
+	addr := serveWithWebConfig(t, `
+tls_server_config:
+  cert_file: `+server.certFile+`
+  key_file: `+server.keyFile+`
+  client_auth_type: RequireAndVerifyClientCert
+  client_ca_file: `+ca.certFile+`
+`)
+	url := "https://" + addr + "/healthz"
+
+	if code := get(t, tlsClient(ca, client), url); code != http.StatusOK {
+		t.Errorf("GET with a client certificate returned %d, want 200", code)
+	}
+	if resp, err := tlsClient(ca, nil).Get(url); err == nil {
+		resp.Body.Close()
+		t.Errorf("GET without a client certificate returned %d, want a TLS error", resp.StatusCode)
+	}
+
+	// A certificate from another CA is rejected as well.
+	_, _, stranger := testPKI(t)
+	if resp, err := tlsClient(ca, stranger).Get(url); err == nil {
+		resp.Body.Close()
+		t.Errorf("GET with an untrusted client certificate returned %d, want a TLS error", resp.StatusCode)
+	}
+}
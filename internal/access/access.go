@@ -0,0 +1,235 @@
+// Package access decides which hosts /probe may send requests to, so the
+// exporter can't be used to reach arbitrary hosts on its network.
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// Reasons a target is rejected, used as the reason label of the rejection counter.
+const (
+	ReasonDenied        = "denied"
+	ReasonNotAllowed    = "not_allowed"
+	ReasonNotConfigured = "not_configured"
+	ReasonUnresolvable  = "unresolvable"
+	ReasonInvalid       = "invalid"
+)
+
+// RejectedError is returned for a target the policy doesn't allow probing.
+type RejectedError struct {
+	Target string
+	Reason string
+	// Detail explains the rejection, e.g. the rule which matched.
+	Detail string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("target %q rejected (%s): %s", e.Target, e.Reason, e.Detail)
+}
+
+// rules is a list of CIDRs, IPs and hostname patterns.
+type rules struct {
+	prefixes []netip.Prefix
+	hosts    []string
+}
+
+// parseRules parses each rule as a CIDR, an IP, or otherwise a hostname
+// pattern, where '*' matches any sequence of characters.
+func parseRules(list []string) (rules, error) {
+	var r rules
+	for _, rule := range list {
+		if strings.Contains(rule, "/") {
+			prefix, err := netip.ParsePrefix(rule)
+			if err != nil {
+				return rules{}, fmt.Errorf("invalid CIDR %q", rule)
+			}
+			r.prefixes = append(r.prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(rule); err == nil {
+			r.prefixes = append(r.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		pattern := strings.ToLower(rule)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return rules{}, fmt.Errorf("invalid hostname pattern %q", rule)
+		}
+		r.hosts = append(r.hosts, pattern)
+	}
+	return r, nil
+}
+
+// matchHost returns the hostname pattern matching host, if any.
+func (r rules) matchHost(host string) (string, bool) {
+	host = strings.ToLower(host)
+	for _, pattern := range r.hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// matchAddr returns the CIDR containing addr, if any.
+func (r rules) matchAddr(addr netip.Addr) (netip.Prefix, bool) {
+	addr = addr.Unmap()
+	for _, prefix := range r.prefixes {
+		if prefix.Contains(addr) {
+			return prefix, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+func (r rules) empty() bool {
+	return len(r.prefixes) == 0 && len(r.hosts) == 0
+}
+
+// Policy allows or rejects probe targets. Deny rules take precedence over
+// allow rules, and when there are allow rules, a target must match one of
+// them. A hostname is checked against the hostname patterns, and each of the
+// addresses it resolves to against the CIDRs.
+type Policy struct {
+	allow rules
+	deny  rules
+
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// NewPolicy returns a Policy enforcing the allow and deny rules. An empty
+// policy allows every target.
+func NewPolicy(allow, deny []string) (*Policy, error) {
+	a, err := parseRules(allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	d, err := parseRules(deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	return &Policy{
+		allow: a,
+		deny:  d,
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}, nil
+}
+
+// Check returns a *RejectedError if target, a host optionally with a port or
+// a URL, may not be probed.
+func (p *Policy) Check(ctx context.Context, target string) error {
+	reject := func(reason, format string, args ...any) error {
+		return &RejectedError{Target: target, Reason: reason, Detail: fmt.Sprintf(format, args...)}
+	}
+	// Check the host the target will be requested at, which a target like
+	// "10.0.0.5#.iot.example.com" must not be able to disguise.
+	host, err := hostOf(target)
+	if err != nil {
+		return reject(ReasonInvalid, "%v", err)
+	}
+	if p.allow.empty() && p.deny.empty() {
+		return nil
+	}
+
+	if pattern, ok := p.deny.matchHost(host); ok {
+		return reject(ReasonDenied, "host matches deny rule %q", pattern)
+	}
+	_, allowedByName := p.allow.matchHost(host)
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else if len(p.deny.prefixes) > 0 || (!allowedByName && len(p.allow.prefixes) > 0) {
+		// Only resolve the host when a CIDR needs checking.
+		addrs, err = p.lookup(ctx, host)
+		if err != nil {
+			return reject(ReasonUnresolvable, "%v", err)
+		}
+		if len(addrs) == 0 {
+			return reject(ReasonUnresolvable, "host has no addresses")
+		}
+	}
+	return p.checkAddrs(reject, addrs, allowedByName)
+}
+
+// CheckConn returns a *RejectedError if host may not be connected to at addr,
+// one of the addresses it resolved to. It's meant to be called when dialing,
+// so the address checked is the one connected to, even if host resolved
+// elsewhere when the target was checked.
+func (p *Policy) CheckConn(host string, addr netip.Addr) error {
+	if p.allow.empty() && p.deny.empty() {
+		return nil
+	}
+	reject := func(reason, format string, args ...any) error {
+		return &RejectedError{Target: host, Reason: reason, Detail: fmt.Sprintf(format, args...)}
+	}
+	if pattern, ok := p.deny.matchHost(host); ok {
+		return reject(ReasonDenied, "host matches deny rule %q", pattern)
+	}
+	_, allowedByName := p.allow.matchHost(host)
+	return p.checkAddrs(reject, []netip.Addr{addr}, allowedByName)
+}
+
+// checkAddrs checks the addresses of a host against the CIDRs, once the host
+// itself passed the hostname patterns.
+func (p *Policy) checkAddrs(reject func(reason, format string, args ...any) error, addrs []netip.Addr, allowedByName bool) error {
+	for _, addr := range addrs {
+		if prefix, ok := p.deny.matchAddr(addr); ok {
+			return reject(ReasonDenied, "address %s matches deny rule %q", addr, prefix)
+		}
+	}
+	if p.allow.empty() || allowedByName {
+		return nil
+	}
+	if len(addrs) == 0 {
+		return reject(ReasonNotAllowed, "host matches no allow rule")
+	}
+	for _, addr := range addrs {
+		if _, ok := p.allow.matchAddr(addr); !ok {
+			return reject(ReasonNotAllowed, "address %s matches no allow rule", addr)
+		}
+	}
+	return nil
+}
+
+// hostOf returns the host a target is requested at: the host of a URL target,
+// or otherwise target without its port, and the brackets of an IPv6 address.
+// Targets which aren't a host, optionally with a port, or an http(s) URL
+// without credentials, are rejected, as the request URL is built from them
+// verbatim.
+func hostOf(target string) (string, error) {
+	if strings.ContainsFunc(target, func(r rune) bool { return r == '\\' || unicode.IsSpace(r) }) {
+		return "", errors.New("target contains a backslash or whitespace")
+	}
+	isURL := strings.Contains(target, "://")
+	raw := target
+	if !isURL {
+		raw = "http://" + target
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid target: %w", err)
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	case u.User != nil:
+		return "", errors.New("target contains credentials")
+	case u.Hostname() == "":
+		return "", errors.New("target has no host")
+	case !isURL && u.Host != target:
+		return "", errors.New("target is not a host or host:port")
+	case isURL && (u.RawQuery != "" || u.ForceQuery || u.Fragment != "" || strings.Contains(target, "#")):
+		return "", errors.New("target URL has a query or fragment")
+	}
+	return u.Hostname(), nil
+}
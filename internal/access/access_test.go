@@ -0,0 +1,127 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func TestNewPolicy_Invalid(t *testing.T) {
+	for _, cse := range []struct {
+		allow, deny []string
+		err         string
+	}{
+		{[]string{"10.0.0.0/33"}, nil, `allow: invalid CIDR "10.0.0.0/33"`},
+		{nil, []string{"[bad"}, `deny: invalid hostname pattern "[bad"`},
+		{[]string{""}, nil, `allow: invalid hostname pattern ""`},
+	} {
+		_, err := NewPolicy(cse.allow, cse.deny)
+		require.NotNil(t, err)
+		assert.Equal(t, cse.err, err.Error())
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	hosts := map[string][]netip.Addr{
+		"awair-office.iot.example.com": {netip.MustParseAddr("10.1.0.5")},
+		"metadata.internal":            {netip.MustParseAddr("169.254.169.254")},
+		"sneaky.example.com":           {netip.MustParseAddr("10.1.0.6"), netip.MustParseAddr("169.254.169.254")},
+		"elsewhere.example.com":        {netip.MustParseAddr("192.168.9.9")},
+	}
+	cases := []struct {
+		name        string
+		allow, deny []string
+		target      string
+		reason      string
+	}{
+		{"no_rules", nil, nil, "anything:80", ""},
+		{"allowed_ip", []string{"10.1.0.0/16"}, nil, "10.1.2.3", ""},
+		{"allowed_ip_port", []string{"10.1.0.0/16"}, nil, "10.1.2.3:8080", ""},
+		{"allowed_ipv6", []string{"fd00::/8"}, nil, "[fd00::1]:80", ""},
+		{"single_ip_rule", []string{"10.1.2.3"}, nil, "10.1.2.4", ReasonNotAllowed},
+		{"ip_not_allowed", []string{"10.1.0.0/16"}, nil, "192.168.1.1", ReasonNotAllowed},
+		{"allowed_by_name", []string{"*.iot.example.com"}, nil, "awair-office.iot.example.com", ""},
+		{"name_case_insensitive", []string{"*.iot.example.com"}, nil, "AWAIR-office.IOT.example.com", ""},
+		{"name_not_allowed", []string{"*.iot.example.com"}, nil, "elsewhere.example.com", ReasonNotAllowed},
+		{"allowed_by_address", []string{"10.1.0.0/16"}, nil, "awair-office.iot.example.com:80", ""},
+		{"denied_ip", nil, []string{"169.254.0.0/16"}, "169.254.169.254", ReasonDenied},
+		{"denied_name", nil, []string{"metadata.*"}, "metadata.internal", ReasonDenied},
+		{"denied_by_address", nil, []string{"169.254.0.0/16"}, "metadata.internal", ReasonDenied},
+		{"deny_beats_allow", []string{"*.example.com"}, []string{"169.254.0.0/16"}, "sneaky.example.com", ReasonDenied},
+		{"all_addresses_allowed", []string{"10.0.0.0/8"}, nil, "sneaky.example.com", ReasonNotAllowed},
+		{"unresolvable", []string{"10.0.0.0/8"}, nil, "missing.example.com", ReasonUnresolvable},
+		{"url_allowed", []string{"*.iot.example.com"}, nil, "https://awair-office.iot.example.com:8443/awair", ""},
+		{"url_denied", nil, []string{"169.254.0.0/16"}, "http://169.254.169.254/latest", ReasonDenied},
+		{"ipv4_mapped", nil, []string{"169.254.0.0/16"}, "[::ffff:169.254.169.254]:80", ReasonDenied},
+		{"fragment", []string{"*.iot.example.com"}, nil, "169.254.169.254#.iot.example.com", ReasonInvalid},
+		{"query", []string{"*.iot.example.com"}, nil, "10.0.0.5?.iot.example.com", ReasonInvalid},
+		{"path", []string{"*.iot.example.com"}, nil, "10.0.0.5/.iot.example.com", ReasonInvalid},
+		{"userinfo", []string{"*.iot.example.com"}, nil, "awair-office.iot.example.com@169.254.169.254", ReasonInvalid},
+		{"backslash", []string{"*.iot.example.com"}, nil, "169.254.169.254\\.iot.example.com", ReasonInvalid},
+		{"whitespace", []string{"*.iot.example.com"}, nil, "169.254.169.254 .iot.example.com", ReasonInvalid},
+		{"url_fragment", []string{"*.iot.example.com"}, nil, "http://169.254.169.254#.iot.example.com", ReasonInvalid},
+		{"url_userinfo", []string{"*.iot.example.com"}, nil, "http://awair-office.iot.example.com@169.254.169.254/", ReasonInvalid},
+		{"url_scheme", nil, nil, "file:///etc/passwd", ReasonInvalid},
+		{"invalid_without_rules", nil, nil, "10.0.0.5#.iot.example.com", ReasonInvalid},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			p, err := NewPolicy(cse.allow, cse.deny)
+			require.Nil(t, err)
+			p.lookup = func(_ context.Context, host string) ([]netip.Addr, error) {
+				addrs, ok := hosts[host]
+				if !ok {
+					return nil, errors.New("no such host")
+				}
+				return addrs, nil
+			}
+
+			err = p.Check(context.Background(), cse.target)
+			if cse.reason == "" {
+				assert.Nil(t, err)
+				return
+			}
+			var rejected *RejectedError
+			require.True(t, errors.As(err, &rejected), "Check() = %v, want a RejectedError", err)
+			assert.Equal(t, cse.reason, rejected.Reason)
+			assert.Equal(t, cse.target, rejected.Target)
+		})
+	}
+}
+
+func TestPolicy_CheckConn(t *testing.T) {
+	cases := []struct {
+		name        string
+		allow, deny []string
+		host, addr  string
+		reason      string
+	}{
+		{"no_rules", nil, nil, "metadata.internal", "169.254.169.254", ""},
+		{"allowed_addr", []string{"10.1.0.0/16"}, nil, "awair-office.iot.example.com", "10.1.0.5", ""},
+		// A host which resolved to an allowed address when checked, and to
+		// another by the time it's dialed.
+		{"rebound_not_allowed", []string{"10.1.0.0/16"}, nil, "awair-office.iot.example.com", "192.168.9.9", ReasonNotAllowed},
+		{"rebound_denied", []string{"*.iot.example.com"}, []string{"169.254.0.0/16"}, "awair-office.iot.example.com", "169.254.169.254", ReasonDenied},
+		{"allowed_by_name", []string{"*.iot.example.com"}, nil, "awair-office.iot.example.com", "192.168.9.9", ""},
+		{"denied_name", nil, []string{"metadata.*"}, "metadata.internal", "10.1.0.5", ReasonDenied},
+		{"ipv4_mapped", nil, []string{"169.254.0.0/16"}, "::ffff:169.254.169.254", "::ffff:169.254.169.254", ReasonDenied},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			p, err := NewPolicy(cse.allow, cse.deny)
+			require.Nil(t, err)
+			err = p.CheckConn(cse.host, netip.MustParseAddr(cse.addr))
+			if cse.reason == "" {
+				assert.Nil(t, err)
+				return
+			}
+			var rejected *RejectedError
+			require.True(t, errors.As(err, &rejected), "CheckConn() = %v, want a RejectedError", err)
+			assert.Equal(t, cse.reason, rejected.Reason)
+		})
+	}
+}
@@ -0,0 +1,515 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"prometheus-awair-exporter/internal/access"
+	"prometheus-awair-exporter/internal/discovery"
+	"prometheus-awair-exporter/internal/exporter"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the exporter's configuration, loaded from the file given by
+// --config.file. Settings missing from the file keep the values of the
+// corresponding command line flags.
+type Config struct {
+	Web        WebConfig         `yaml:"web"`
+	LogLevel   string            `yaml:"log_level"`
+	Collectors CollectorsConfig  `yaml:"collectors"`
+	Probe      ProbeConfig       `yaml:"probe"`
+	Modules    map[string]Module `yaml:"modules"`
+	Access     AccessConfig      `yaml:"access"`
+	Discovery  DiscoveryConfig   `yaml:"discovery"`
+	Targets    []Target          `yaml:"targets"`
+}
+
+type WebConfig struct {
+	// ListenAddresses are host:port pairs, or unix:<path> for a unix socket.
+	ListenAddresses StringList `yaml:"listen_address"`
+	// RoutePrefix is prepended to every route, e.g. when the exporter is
+	// served from a subpath by a reverse proxy.
+	RoutePrefix   string `yaml:"route_prefix"`
+	TelemetryPath string `yaml:"telemetry_path"`
+	// ReloadToken enables POST /-/reload for requests carrying it as a
+	// bearer token.
+	ReloadToken string `yaml:"reload_token"`
+}
+
+// Routes served by the exporter other than the telemetry path, relative to
+// the route prefix.
+var Routes = []string{"/healthz", "/probe", "/sd", "/-/reload"}
+
+// Path returns route under the route prefix.
+func (w *WebConfig) Path(route string) string {
+	return strings.TrimSuffix(w.RoutePrefix, "/") + route
+}
+
+// StringList is a list of strings, which can also be written as a single
+// string in the config file.
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = StringList{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// CollectorsConfig enables the Go runtime and process collectors on /metrics.
+type CollectorsConfig struct {
+	Go      bool `yaml:"go"`
+	Process bool `yaml:"process"`
+}
+
+type ProbeConfig struct {
+	Timeout           time.Duration   `yaml:"timeout"`
+	ConfigCacheTTL    time.Duration   `yaml:"config_cache_ttl"`
+	ReadingTimestamps bool            `yaml:"reading_timestamps"`
+	RawFields         RawFieldsConfig `yaml:"raw_fields"`
+	// DeviceLabels attaches the device_uuid of the device to every metric.
+	DeviceLabels bool `yaml:"device_labels"`
+	// DerivedMetrics exports comfort indices computed from the readings.
+	DerivedMetrics bool `yaml:"derived_metrics"`
+	// AQIStandards are the standards to compute an Air Quality Index with,
+	// e.g. "us_epa".
+	AQIStandards []string `yaml:"aqi_standards"`
+}
+
+type RawFieldsConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Deny    []string `yaml:"deny"`
+}
+
+// AccessConfig restricts the hosts /probe sends requests to. Configured
+// targets can always be probed.
+type AccessConfig struct {
+	// ConfiguredTargetsOnly rejects every target which isn't configured.
+	ConfiguredTargetsOnly bool `yaml:"configured_targets_only"`
+	// Allow and Deny are CIDRs, IPs or hostname patterns like "*.iot.example.com".
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// DiscoveryConfig finds Awair devices on the network, which can then be
+// probed and are listed by /sd like configured targets.
+type DiscoveryConfig struct {
+	// Interval is how often to look for devices.
+	Interval time.Duration `yaml:"interval"`
+	MDNS     MDNSConfig    `yaml:"mdns"`
+	Scan     ScanConfig    `yaml:"scan"`
+}
+
+// MDNSConfig browses mDNS / DNS-SD for devices.
+type MDNSConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Service string `yaml:"service"`
+	Domain  string `yaml:"domain"`
+	// NamePattern is a case-insensitive glob the instance name must match.
+	NamePattern string `yaml:"name_pattern"`
+	// Timeout is how long to wait for responses.
+	Timeout time.Duration `yaml:"timeout"`
+	// Interface limits browsing to one network interface.
+	Interface string `yaml:"interface"`
+}
+
+// ScanConfig sweeps address ranges for devices, for networks where mDNS
+// doesn't reach the exporter. Scanning is enabled by listing CIDRs.
+type ScanConfig struct {
+	CIDRs []string `yaml:"cidrs"`
+	Port  int      `yaml:"port"`
+	// Concurrency is how many addresses are checked at once.
+	Concurrency int `yaml:"concurrency"`
+}
+
+// Enabled reports whether any discovery mechanism is enabled.
+func (d *DiscoveryConfig) Enabled() bool {
+	return d.MDNS.Enabled || len(d.Scan.CIDRs) > 0
+}
+
+// DefaultModule is the module used by probes which don't ask for one. It
+// applies the probe settings unchanged, unless the config overrides it.
+const DefaultModule = "default"
+
+// LegacyModule is the module scrape configs passed before modules existed,
+// when it was ignored. It's a deprecated alias of DefaultModule, so those
+// scrape configs keep working.
+const LegacyModule = "http_2xx"
+
+// Module is a profile selected with /probe?module=..., changing how the target
+// is probed. Unset settings keep the values from the probe section.
+type Module struct {
+	Timeout time.Duration `yaml:"timeout"`
+	// Metrics lists the metric groups to export; every group if empty.
+	Metrics []string `yaml:"metrics"`
+	// UnitSystem is "metric" (the default) or "imperial".
+	UnitSystem string `yaml:"unit_system"`
+	// DerivedMetrics overrides probe.derived_metrics, either way.
+	DerivedMetrics *bool `yaml:"derived_metrics"`
+	// AQIStandards overrides probe.aqi_standards, with an empty list disabling
+	// the AQI.
+	AQIStandards []string `yaml:"aqi_standards"`
+	// ConfigCacheTTL overrides probe.config_cache_ttl, with 0 bypassing the cache.
+	ConfigCacheTTL *time.Duration `yaml:"config_cache_ttl"`
+}
+
+// Target is an Awair device known to the exporter. It can be probed by its
+// host, or by its name as a stable alias for the host.
+type Target struct {
+	Name string `yaml:"name"`
+	Host string `yaml:"host"`
+	// Room, Floor and Building are attached to every series probed from
+	// the target as labels of the same name.
+	Room     string `yaml:"room"`
+	Floor    string `yaml:"floor"`
+	Building string `yaml:"building"`
+	// Labels are attached to every series probed from the target.
+	Labels map[string]string `yaml:"labels"`
+	// DisplayName is attached to every series probed from the target as the
+	// display_name label, e.g. for dashboards.
+	DisplayName string `yaml:"display_name"`
+	// PollInterval, if set, polls the target in the background rather than
+	// only when it's probed.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// TLS, BasicAuth and BearerToken apply to requests to the host, usually
+	// an https:// URL of a reverse proxy in front of the device.
+	TLS         TLSConfig  `yaml:"tls_config"`
+	BasicAuth   *BasicAuth `yaml:"basic_auth"`
+	BearerToken string     `yaml:"bearer_token"`
+}
+
+type TLSConfig struct {
+	// CAFile replaces the system CAs with those in the file.
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+var (
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	targetNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.:-]*$`)
+
+	// reservedLabels are added to every metric by the exporter or Prometheus,
+	// so can't be target labels, nor can the labels of the exporter's metrics.
+	reservedLabels = map[string]bool{
+		"instance": true,
+		"job":      true,
+
+		exporter.DeviceUUIDLabel:  true,
+		exporter.DisplayNameLabel: true,
+	}
+)
+
+// Load reads the config file at path. Settings missing from the file keep
+// their values from base.
+func Load(path string, base Config) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data, base)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates a config. Settings missing from data keep their
+// values from base.
+func Parse(data []byte, base Config) (*Config, error) {
+	cfg := base
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the config for mistakes, describing the first one found.
+func (c *Config) Validate() error {
+	if err := c.Web.validate(); err != nil {
+		return fmt.Errorf("web.%w", err)
+	}
+	if c.LogLevel != "" {
+		if _, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+			return fmt.Errorf("log_level: unknown level %q", c.LogLevel)
+		}
+	}
+	if c.Probe.Timeout <= 0 {
+		return fmt.Errorf("probe.timeout: must be positive, got %s", c.Probe.Timeout)
+	}
+	if c.Probe.ConfigCacheTTL < 0 {
+		return fmt.Errorf("probe.config_cache_ttl: must not be negative, got %s", c.Probe.ConfigCacheTTL)
+	}
+	if err := validateAQIStandards(c.Probe.AQIStandards); err != nil {
+		return fmt.Errorf("probe.aqi_standards: %w", err)
+	}
+
+	if _, err := access.NewPolicy(c.Access.Allow, c.Access.Deny); err != nil {
+		return fmt.Errorf("access.%w", err)
+	}
+	if err := c.Discovery.validate(); err != nil {
+		return fmt.Errorf("discovery.%w", err)
+	}
+	for name, m := range c.Modules {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("modules.%s: %w", name, err)
+		}
+	}
+
+	names := map[string]int{}
+	hosts := map[string]int{}
+	for i, t := range c.Targets {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+		if j, ok := names[t.Name]; ok {
+			return fmt.Errorf("targets[%d]: name %q is already used by targets[%d]", i, t.Name, j)
+		}
+		names[t.Name] = i
+		if j, ok := hosts[t.Host]; ok {
+			return fmt.Errorf("targets[%d]: host %q is already used by targets[%d]", i, t.Host, j)
+		}
+		hosts[t.Host] = i
+	}
+	for i, t := range c.Targets {
+		if j, ok := hosts[t.Name]; ok && j != i {
+			return fmt.Errorf("targets[%d]: name %q is the host of targets[%d], so /probe?target=%s would be ambiguous", i, t.Name, j, t.Name)
+		}
+	}
+	return nil
+}
+
+func (w *WebConfig) validate() error {
+	if len(w.ListenAddresses) == 0 {
+		return errors.New("listen_address: must not be empty")
+	}
+	for i, addr := range w.ListenAddresses {
+		if addr == "" || addr == "unix:" {
+			return fmt.Errorf("listen_address[%d]: must not be empty", i)
+		}
+	}
+	if w.RoutePrefix != "" && !strings.HasPrefix(w.RoutePrefix, "/") {
+		return fmt.Errorf("route_prefix: %q must start with '/'", w.RoutePrefix)
+	}
+	if !strings.HasPrefix(w.TelemetryPath, "/") {
+		return fmt.Errorf("telemetry_path: %q must start with '/'", w.TelemetryPath)
+	}
+	for _, route := range Routes {
+		if w.TelemetryPath == route {
+			return fmt.Errorf("telemetry_path: %q is already used by the exporter", w.TelemetryPath)
+		}
+	}
+	return nil
+}
+
+func (d *DiscoveryConfig) validate() error {
+	if !d.Enabled() {
+		return nil
+	}
+	if d.Interval <= 0 {
+		return fmt.Errorf("interval: must be positive, got %s", d.Interval)
+	}
+	if m := d.MDNS; m.Enabled {
+		if m.Service == "" {
+			return errors.New("mdns.service: must not be empty")
+		}
+		if _, err := path.Match(strings.ToLower(m.NamePattern), ""); err != nil {
+			return fmt.Errorf("mdns.name_pattern: invalid pattern %q", m.NamePattern)
+		}
+		if m.Timeout <= 0 {
+			return fmt.Errorf("mdns.timeout: must be positive, got %s", m.Timeout)
+		}
+	}
+	if s := d.Scan; len(s.CIDRs) > 0 {
+		if _, err := discovery.NewScanFinder(s.CIDRs, s.Port, s.Concurrency); err != nil {
+			return fmt.Errorf("scan.cidrs: %w", err)
+		}
+		if s.Port < 1 || s.Port > 65535 {
+			return fmt.Errorf("scan.port: must be between 1 and 65535, got %d", s.Port)
+		}
+		if s.Concurrency <= 0 {
+			return fmt.Errorf("scan.concurrency: must be positive, got %d", s.Concurrency)
+		}
+	}
+	return nil
+}
+
+func (m *Module) validate() error {
+	if m.Timeout < 0 {
+		return fmt.Errorf("timeout: must not be negative, got %s", m.Timeout)
+	}
+	for _, group := range m.Metrics {
+		if _, err := exporter.ParseMetricGroup(group); err != nil {
+			return fmt.Errorf("metrics: %w", err)
+		}
+	}
+	if _, err := exporter.ParseUnitSystem(m.UnitSystem); err != nil {
+		return fmt.Errorf("unit_system: %w", err)
+	}
+	if err := validateAQIStandards(m.AQIStandards); err != nil {
+		return fmt.Errorf("aqi_standards: %w", err)
+	}
+	if m.ConfigCacheTTL != nil && *m.ConfigCacheTTL < 0 {
+		return fmt.Errorf("config_cache_ttl: must not be negative, got %s", *m.ConfigCacheTTL)
+	}
+	return nil
+}
+
+func validateAQIStandards(standards []string) error {
+	for _, standard := range standards {
+		if _, err := exporter.ParseAQIStandard(standard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Module returns the module called name. The empty name and DefaultModule
+// refer to the default module, which needn't be configured, as does
+// LegacyModule unless it's configured.
+func (c *Config) Module(name string) (*Module, bool) {
+	if name == "" {
+		name = DefaultModule
+	}
+	if m, ok := c.Modules[name]; ok {
+		return &m, true
+	}
+	switch name {
+	case DefaultModule:
+		return &Module{}, true
+	case LegacyModule:
+		return c.Module(DefaultModule)
+	}
+	return nil, false
+}
+
+// IsLegacyModule reports whether name refers to the default module through
+// the deprecated LegacyModule alias.
+func (c *Config) IsLegacyModule(name string) bool {
+	_, configured := c.Modules[name]
+	return name == LegacyModule && !configured
+}
+
+func (t *Target) validate() error {
+	if t.Name == "" {
+		return errors.New("name: must not be empty")
+	}
+	if !targetNameRE.MatchString(t.Name) {
+		return fmt.Errorf("name: %q must only contain letters, digits, '_', '.', ':' and '-'", t.Name)
+	}
+	if t.Host == "" {
+		return errors.New("host: must not be empty")
+	}
+	if strings.Contains(t.Host, "://") {
+		u, err := url.Parse(t.Host)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("host: %q must be an http:// or https:// URL without credentials, query or fragment", t.Host)
+		}
+	} else if strings.ContainsAny(t.Host, "/?# ") {
+		return fmt.Errorf("host: %q must be a hostname or IP, optionally with a port, or a URL", t.Host)
+	}
+	if t.TLS.CAFile != "" {
+		if _, err := exporter.LoadTLSConfig(t.TLS.CAFile, t.TLS.InsecureSkipVerify); err != nil {
+			return fmt.Errorf("tls_config: ca_file: %w", err)
+		}
+	}
+	if t.BasicAuth != nil {
+		if t.BasicAuth.Username == "" {
+			return errors.New("basic_auth: username: must not be empty")
+		}
+		if t.BearerToken != "" {
+			return errors.New("basic_auth and bearer_token are mutually exclusive")
+		}
+	}
+	for name := range t.Labels {
+		if _, ok := t.locationLabels()[name]; ok {
+			return fmt.Errorf("labels: %q is already set by the target's %s", name, name)
+		}
+		if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("labels: %q is not a valid label name", name)
+		}
+		if reservedLabels[name] || exporter.IsReservedLabel(name) {
+			return fmt.Errorf("labels: %q is reserved by the exporter", name)
+		}
+	}
+	if t.PollInterval < 0 {
+		return fmt.Errorf("poll_interval: must not be negative, got %s", t.PollInterval)
+	}
+	return nil
+}
+
+// locationLabels returns the room, floor and building of the target which are set.
+func (t *Target) locationLabels() map[string]string {
+	labels := map[string]string{}
+	for name, value := range map[string]string{
+		"room":     t.Room,
+		"floor":    t.Floor,
+		"building": t.Building,
+	} {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+	return labels
+}
+
+// AllLabels returns every label to attach to series probed from the target.
+func (t *Target) AllLabels() map[string]string {
+	labels := t.locationLabels()
+	for name, value := range t.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// Resolve returns the target which target, a target name or host, refers to.
+// Names take precedence over hosts.
+func (c *Config) Resolve(target string) (*Target, bool) {
+	for i := range c.Targets {
+		if c.Targets[i].Name == target {
+			return &c.Targets[i], true
+		}
+	}
+	return c.TargetByHost(target)
+}
+
+// TargetByHost returns the configured target with the given host.
+func (c *Config) TargetByHost(host string) (*Target, bool) {
+	for i := range c.Targets {
+		if c.Targets[i].Host == host {
+			return &c.Targets[i], true
+		}
+	}
+	return nil, false
+}
+
+// HasTLS reports whether the target has its own TLS settings.
+func (t *Target) HasTLS() bool {
+	return t.TLS != TLSConfig{}
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func baseConfig() Config {
+	return Config{
+		Web:      WebConfig{ListenAddresses: StringList{":8080"}, TelemetryPath: "/metrics"},
+		LogLevel: "info",
+		Probe: ProbeConfig{
+			Timeout:        10 * time.Second,
+			ConfigCacheTTL: 5 * time.Minute,
+		},
+		Discovery: DiscoveryConfig{
+			Interval: 5 * time.Minute,
+			MDNS: MDNSConfig{
+				Service:     "_http._tcp",
+				Domain:      "local",
+				NamePattern: "awair*",
+				Timeout:     5 * time.Second,
+			},
+			Scan: ScanConfig{Port: 80, Concurrency: 32},
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	cfg, err := Parse([]byte(`
+web:
+  listen_address: ":9517"
+log_level: debug
+collectors:
+  go: true
+probe:
+  timeout: 4s
+  device_labels: true
+  derived_metrics: true
+  aqi_standards: [us_epa, eu_caqi]
+  raw_fields:
+    enabled: true
+    deny: [secret]
+targets:
+  - name: living-room
+    host: 192.168.1.20
+    labels:
+      room: living
+      floor: "1"
+  - name: office
+    host: 192.168.1.21:8080
+    display_name: Office
+    poll_interval: 30s
+`), baseConfig())
+	require.Nil(err)
+
+	assert.Equal(StringList{":9517"}, cfg.Web.ListenAddresses)
+	assert.Equal("debug", cfg.LogLevel)
+	assert.True(cfg.Collectors.Go)
+	assert.False(cfg.Collectors.Process)
+	assert.Equal(4*time.Second, cfg.Probe.Timeout)
+	// Unset in the file, so kept from the base config.
+	assert.Equal(5*time.Minute, cfg.Probe.ConfigCacheTTL)
+	assert.True(cfg.Probe.DeviceLabels)
+	assert.True(cfg.Probe.DerivedMetrics)
+	assert.Equal([]string{"us_epa", "eu_caqi"}, cfg.Probe.AQIStandards)
+	assert.Equal(RawFieldsConfig{Enabled: true, Deny: []string{"secret"}}, cfg.Probe.RawFields)
+	assert.Equal([]Target{
+		{Name: "living-room", Host: "192.168.1.20", Labels: map[string]string{"room": "living", "floor": "1"}},
+		{Name: "office", Host: "192.168.1.21:8080", DisplayName: "Office", PollInterval: 30 * time.Second},
+	}, cfg.Targets)
+
+	target, ok := cfg.TargetByHost("192.168.1.21:8080")
+	assert.True(ok)
+	assert.Equal("office", target.Name)
+	_, ok = cfg.TargetByHost("office")
+	assert.False(ok)
+}
+
+func TestParse_Empty(t *testing.T) {
+	cfg, err := Parse([]byte(""), baseConfig())
+	require.Nil(t, err)
+	assert.Equal(t, baseConfig(), *cfg)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"unknown_field", "listen_address: :8080", "field listen_address not found"},
+		{"bad_yaml", "targets: [", "yaml:"},
+		{"bad_duration", "probe:\n  timeout: soon", "cannot unmarshal"},
+		{"empty_listen_address", "web:\n  listen_address: ''", "web.listen_address[0]: must not be empty"},
+		{"no_listen_addresses", "web:\n  listen_address: []", "web.listen_address: must not be empty"},
+		{"empty_unix_socket", "web:\n  listen_address: [':8080', 'unix:']", "web.listen_address[1]: must not be empty"},
+		{"relative_route_prefix", "web:\n  route_prefix: awair", `web.route_prefix: "awair" must start with '/'`},
+		{"relative_telemetry_path", "web:\n  telemetry_path: metrics", `web.telemetry_path: "metrics" must start with '/'`},
+		{"telemetry_path_used", "web:\n  telemetry_path: /probe", `web.telemetry_path: "/probe" is already used`},
+		{"bad_log_level", "log_level: chatty", `log_level: unknown level "chatty"`},
+		{"zero_timeout", "probe:\n  timeout: 0s", "probe.timeout: must be positive"},
+		{"negative_cache_ttl", "probe:\n  config_cache_ttl: -1s", "probe.config_cache_ttl: must not be negative"},
+		{"unknown_aqi_standard", "probe:\n  aqi_standards: [us]", `probe.aqi_standards: unknown AQI standard "us"`},
+		{"module_unknown_aqi_standard", "modules:\n  aqi:\n    aqi_standards: [cn]", `modules.aqi: aqi_standards: unknown AQI standard "cn"`},
+		{"target_no_name", "targets:\n  - host: 1.2.3.4", "targets[0]: name: must not be empty"},
+		{"target_bad_name", "targets:\n  - name: living room\n    host: 1.2.3.4", `targets[0]: name: "living room" must only contain`},
+		{"target_no_host", "targets:\n  - name: a", "targets[0]: host: must not be empty"},
+		{"target_host_path", "targets:\n  - name: a\n    host: 1.2.3.4/awair", `targets[0]: host: "1.2.3.4/awair" must be a hostname or IP`},
+		{"target_host_bad_scheme", "targets:\n  - name: a\n    host: ftp://1.2.3.4/", `targets[0]: host: "ftp://1.2.3.4/" must be an http:// or https:// URL`},
+		{"target_host_url_credentials", "targets:\n  - name: a\n    host: https://user:pw@proxy/", `targets[0]: host: "https://user:pw@proxy/" must be an http:// or https:// URL without credentials`},
+		{"target_host_url_query", "targets:\n  - name: a\n    host: https://proxy/?device=1", "must be an http:// or https:// URL without credentials, query or fragment"},
+		{"target_missing_ca", "targets:\n  - name: a\n    host: https://proxy/\n    tls_config:\n      ca_file: /nonexistent/ca.pem", "targets[0]: tls_config: ca_file:"},
+		{"target_basic_auth_no_user", "targets:\n  - name: a\n    host: https://proxy/\n    basic_auth:\n      password: x", "targets[0]: basic_auth: username: must not be empty"},
+		{"target_two_auths", "targets:\n  - name: a\n    host: https://proxy/\n    basic_auth:\n      username: x\n    bearer_token: y", "targets[0]: basic_auth and bearer_token are mutually exclusive"},
+		{"target_bad_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      bad-label: x", `targets[0]: labels: "bad-label" is not a valid label name`},
+		{"target_internal_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      __address__: x", `targets[0]: labels: "__address__" is not a valid label name`},
+		{"target_reserved_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      sensor: x", `targets[0]: labels: "sensor" is reserved`},
+		{"target_device_uuid_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      device_uuid: x", `targets[0]: labels: "device_uuid" is reserved`},
+		{"target_model_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      model: x", `targets[0]: labels: "model" is reserved`},
+		{"target_firmware_version_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      firmware_version: x", `targets[0]: labels: "firmware_version" is reserved`},
+		{"target_timezone_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      timezone: x", `targets[0]: labels: "timezone" is reserved`},
+		{"target_voc_feature_set_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      voc_feature_set: x", `targets[0]: labels: "voc_feature_set" is reserved`},
+		{"target_wifi_mac_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      wifi_mac: x", `targets[0]: labels: "wifi_mac" is reserved`},
+		{"target_ssid_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      ssid: x", `targets[0]: labels: "ssid" is reserved`},
+		{"target_ip_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      ip: x", `targets[0]: labels: "ip" is reserved`},
+		{"target_netmask_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      netmask: x", `targets[0]: labels: "netmask" is reserved`},
+		{"target_gateway_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      gateway: x", `targets[0]: labels: "gateway" is reserved`},
+		{"target_standard_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      standard: x", `targets[0]: labels: "standard" is reserved`},
+		{"target_pollutant_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      pollutant: x", `targets[0]: labels: "pollutant" is reserved`},
+		{"target_category_label", "targets:\n  - name: a\n    host: 1.2.3.4\n    labels:\n      category: x", `targets[0]: labels: "category" is reserved`},
+		{"target_negative_poll", "targets:\n  - name: a\n    host: 1.2.3.4\n    poll_interval: -1s", "targets[0]: poll_interval: must not be negative"},
+		{"target_label_conflicts_room", "targets:\n  - name: a\n    host: 1.2.3.4\n    room: office\n    labels:\n      room: kitchen", `targets[0]: labels: "room" is already set by the target's room`},
+		{"name_is_other_host", "targets:\n  - name: a\n    host: 1.2.3.4\n  - name: 1.2.3.4\n    host: 1.2.3.5", `targets[1]: name "1.2.3.4" is the host of targets[0]`},
+		{"duplicate_name", "targets:\n  - name: a\n    host: 1.2.3.4\n  - name: a\n    host: 1.2.3.5", `targets[1]: name "a" is already used by targets[0]`},
+		{"module_negative_timeout", "modules:\n  fast:\n    timeout: -1s", "modules.fast: timeout: must not be negative"},
+		{"module_unknown_group", "modules:\n  fast:\n    metrics: [everything]", `modules.fast: metrics: unknown metric group "everything"`},
+		{"module_unknown_units", "modules:\n  fast:\n    unit_system: kelvin", `modules.fast: unit_system: unknown unit system "kelvin"`},
+		{"module_negative_cache_ttl", "modules:\n  fast:\n    config_cache_ttl: -1s", "modules.fast: config_cache_ttl: must not be negative"},
+		{"access_bad_cidr", "access:\n  allow: [10.0.0.0/40]", `access.allow: invalid CIDR "10.0.0.0/40"`},
+		{"access_bad_pattern", "access:\n  deny: ['[x']", `access.deny: invalid hostname pattern "[x"`},
+		{"discovery_zero_interval", "discovery:\n  interval: 0s\n  mdns:\n    enabled: true", "discovery.interval: must be positive"},
+		{"discovery_mdns_no_service", "discovery:\n  mdns:\n    enabled: true\n    service: ''", "discovery.mdns.service: must not be empty"},
+		{"discovery_mdns_bad_pattern", "discovery:\n  mdns:\n    enabled: true\n    name_pattern: '[x'", `discovery.mdns.name_pattern: invalid pattern "[x"`},
+		{"discovery_mdns_zero_timeout", "discovery:\n  mdns:\n    enabled: true\n    timeout: 0s", "discovery.mdns.timeout: must be positive"},
+		{"discovery_scan_bad_cidr", "discovery:\n  scan:\n    cidrs: [192.168.0.0]", `discovery.scan.cidrs: invalid CIDR "192.168.0.0"`},
+		{"discovery_scan_too_large", "discovery:\n  scan:\n    cidrs: [10.0.0.0/8]", "discovery.scan.cidrs: 10.0.0.0/8 has more than 65536 addresses"},
+		{"discovery_scan_bad_port", "discovery:\n  scan:\n    cidrs: [192.168.0.0/24]\n    port: 0", "discovery.scan.port: must be between 1 and 65535"},
+		{"discovery_scan_zero_concurrency", "discovery:\n  scan:\n    cidrs: [192.168.0.0/24]\n    concurrency: 0", "discovery.scan.concurrency: must be positive"},
+		{"duplicate_host", "targets:\n  - name: a\n    host: 1.2.3.4\n  - name: b\n    host: 1.2.3.4", `targets[1]: host "1.2.3.4" is already used by targets[0]`},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			_, err := Parse([]byte(cse.config), baseConfig())
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), cse.err)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.Nil(t, os.WriteFile(path, []byte("log_level: chatty\n"), 0o600))
+
+	_, err := Load(path, baseConfig())
+	assert.NotNil(err)
+	assert.Contains(err.Error(), path)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"), baseConfig())
+	assert.NotNil(err)
+}
+
+func TestLoad_Example(t *testing.T) {
+	cfg, err := Load(filepath.Join("..", "..", "config.example.yaml"), baseConfig())
+	require.Nil(t, err)
+	assert.Equal(t, 3, len(cfg.Targets))
+}
+
+func TestParse_ListenAddresses(t *testing.T) {
+	cfg, err := Parse([]byte(`
+web:
+  listen_address:
+    - "[::1]:9517"
+    - unix:/run/awair-exporter.sock
+  route_prefix: /awair/
+  telemetry_path: /self-metrics
+`), baseConfig())
+	require.Nil(t, err)
+	assert.Equal(t, StringList{"[::1]:9517", "unix:/run/awair-exporter.sock"}, cfg.Web.ListenAddresses)
+	assert.Equal(t, "/awair/probe", cfg.Web.Path("/probe"))
+	assert.Equal(t, "/awair/self-metrics", cfg.Web.Path(cfg.Web.TelemetryPath))
+
+	cfg.Web.RoutePrefix = ""
+	assert.Equal(t, "/probe", cfg.Web.Path("/probe"))
+}
+
+func TestParse_TargetConnection(t *testing.T) {
+	caFile := filepath.Join("testdata", "ca.pem")
+	cfg, err := Parse([]byte(`
+targets:
+  - name: office
+    host: https://proxy.example.com/awair/office
+    tls_config:
+      ca_file: `+caFile+`
+    basic_auth:
+      username: prometheus
+      password: s3cret
+  - name: lab
+    host: http://10.0.0.5:8080
+    tls_config:
+      insecure_skip_verify: true
+    bearer_token: t0ken
+`), baseConfig())
+	require.Nil(t, err)
+	assert.Equal(t, TLSConfig{CAFile: caFile}, cfg.Targets[0].TLS)
+	assert.Equal(t, &BasicAuth{Username: "prometheus", Password: "s3cret"}, cfg.Targets[0].BasicAuth)
+	assert.True(t, cfg.Targets[0].HasTLS())
+	assert.Equal(t, "t0ken", cfg.Targets[1].BearerToken)
+	assert.True(t, cfg.Targets[1].HasTLS())
+
+	target, ok := cfg.Resolve("https://proxy.example.com/awair/office")
+	assert.True(t, ok)
+	assert.Equal(t, "office", target.Name)
+}
+
+func TestModule(t *testing.T) {
+	assert := assert.New(t)
+	cfg, err := Parse([]byte(`
+modules:
+  climate:
+    timeout: 2s
+    metrics: [sensors]
+    unit_system: imperial
+    derived_metrics: false
+    aqi_standards: [in_naqi]
+    config_cache_ttl: 0s
+`), baseConfig())
+	require.Nil(t, err)
+
+	m, ok := cfg.Module("climate")
+	assert.True(ok)
+	noCache := time.Duration(0)
+	off := false
+	assert.Equal(&Module{
+		Timeout:        2 * time.Second,
+		Metrics:        []string{"sensors"},
+		UnitSystem:     "imperial",
+		DerivedMetrics: &off,
+		AQIStandards:   []string{"in_naqi"},
+		ConfigCacheTTL: &noCache,
+	}, m)
+
+	for _, name := range []string{"", DefaultModule} {
+		m, ok = cfg.Module(name)
+		assert.True(ok)
+		assert.Equal(&Module{}, m)
+	}
+	// The deprecated alias of the default module.
+	m, ok = cfg.Module(LegacyModule)
+	assert.True(ok)
+	assert.Equal(&Module{}, m)
+	assert.True(cfg.IsLegacyModule(LegacyModule))
+	assert.False(cfg.IsLegacyModule(DefaultModule))
+
+	_, ok = cfg.Module("icmp")
+	assert.False(ok)
+
+	cfg.Modules[DefaultModule] = Module{UnitSystem: "imperial"}
+	m, ok = cfg.Module("")
+	assert.True(ok)
+	assert.Equal("imperial", m.UnitSystem)
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+	cfg, err := Parse([]byte(`
+targets:
+  - name: living-room
+    host: 192.168.1.20
+    room: living
+    floor: "1"
+    building: hq
+    labels:
+      sensor_owner: facilities
+  - name: office
+    host: 192.168.1.21
+`), baseConfig())
+	require.Nil(t, err)
+
+	target, ok := cfg.Resolve("living-room")
+	assert.True(ok)
+	assert.Equal("192.168.1.20", target.Host)
+	assert.Equal(map[string]string{
+		"room":         "living",
+		"floor":        "1",
+		"building":     "hq",
+		"sensor_owner": "facilities",
+	}, target.AllLabels())
+
+	target, ok = cfg.Resolve("192.168.1.21")
+	assert.True(ok)
+	assert.Equal("office", target.Name)
+	assert.Equal(map[string]string{}, target.AllLabels())
+
+	_, ok = cfg.Resolve("kitchen")
+	assert.False(ok)
+}
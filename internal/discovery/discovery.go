@@ -0,0 +1,255 @@
+// Package discovery finds Awair devices on the local network, so they can be
+// probed without being listed in the config file.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"prometheus-awair-exporter/internal/access"
+	"prometheus-awair-exporter/internal/exporter"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultInterval is how often discovery looks for devices when no interval
+// is configured.
+const DefaultInterval = 5 * time.Minute
+
+// expiryIntervals is how many intervals a device is remembered for after it
+// was last found. A device may miss a round, e.g. when an mDNS response is lost.
+const expiryIntervals = 3
+
+// defaultConcurrency is how many candidates are confirmed at once.
+const defaultConcurrency = 8
+
+// minLookupRefresh is how often lookups of unknown devices may trigger a
+// refresh at most, so clients asking for made-up device_uuids can't keep the
+// exporter sweeping the network.
+const minLookupRefresh = 30 * time.Second
+
+// Finder looks for hosts which may be Awair devices. Each candidate is
+// confirmed by fetching its config before it's registered.
+type Finder interface {
+	// Name identifies the finder, as the Source of the devices it finds.
+	Name() string
+	Find(ctx context.Context) ([]string, error)
+}
+
+// concurrencyLimiter is implemented by finders which set how many of their
+// candidates are confirmed at once, overriding the discoverer's concurrency.
+type concurrencyLimiter interface {
+	Concurrency() int
+}
+
+// Discoverer periodically asks its finders for candidates, and registers
+// those which turn out to be Awair devices.
+type Discoverer struct {
+	registry    *Registry
+	finders     []Finder
+	interval    time.Duration
+	policy      *access.Policy
+	concurrency int
+	opts        []exporter.Option
+	now         func() time.Time
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// lookupRefresh is held by the lookup refreshing the devices, and guards
+	// lastLookupRefresh.
+	lookupRefresh     chan struct{}
+	lastLookupRefresh time.Time
+}
+
+type Option func(*Discoverer)
+
+// WithAccessPolicy skips the candidates policy doesn't allow probing.
+func WithAccessPolicy(policy *access.Policy) Option {
+	return func(d *Discoverer) {
+		d.policy = policy
+	}
+}
+
+// WithConcurrency sets how many candidates are confirmed at once.
+func WithConcurrency(n int) Option {
+	return func(d *Discoverer) {
+		if n > 0 {
+			d.concurrency = n
+		}
+	}
+}
+
+// WithExporterOptions configures the requests confirming candidates, e.g.
+// with WithHTTPClient or WithTimeout.
+func WithExporterOptions(opts ...exporter.Option) Option {
+	return func(d *Discoverer) {
+		d.opts = opts
+	}
+}
+
+// NewDiscoverer returns a Discoverer registering the devices its finders find
+// in registry, every interval once started.
+func NewDiscoverer(registry *Registry, interval time.Duration, finders []Finder, opts ...Option) *Discoverer {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	d := &Discoverer{
+		registry:      registry,
+		finders:       finders,
+		interval:      interval,
+		concurrency:   defaultConcurrency,
+		now:           time.Now,
+		lookupRefresh: make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Start looks for devices right away, then every interval until ctx is done or
+// the discoverer is stopped.
+func (d *Discoverer) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	d.mu.Lock()
+	d.cancel, d.done = cancel, done
+	d.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			d.Refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops a started discoverer, waiting for a round in progress to finish.
+func (d *Discoverer) Stop() {
+	d.mu.Lock()
+	cancel, done := d.cancel, d.done
+	d.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Refresh asks every finder for candidates once, registers the devices among
+// them, and forgets devices which haven't been found for a while.
+func (d *Discoverer) Refresh(ctx context.Context) {
+	// Expiry is measured from the start of the round, since sweeping a large
+	// subnet may take longer than the devices found early in it are remembered.
+	start := d.now()
+	for _, f := range d.finders {
+		hosts, err := f.Find(ctx)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Warn().Err(err).Str("source", f.Name()).Msg("Failed to look for Awair devices")
+			}
+			continue
+		}
+		concurrency := d.concurrency
+		if l, ok := f.(concurrencyLimiter); ok && l.Concurrency() > 0 {
+			concurrency = l.Concurrency()
+		}
+		d.confirmAll(ctx, f.Name(), hosts, concurrency)
+	}
+	if ctx.Err() == nil {
+		d.registry.Expire(start.Add(-expiryIntervals * d.interval))
+	}
+}
+
+// Lookup returns the device with the given device_uuid. A device which isn't
+// known yet is looked for with a refresh, unless a lookup refreshed recently.
+// Concurrent lookups share a refresh.
+func (d *Discoverer) Lookup(ctx context.Context, uuid string) (Device, bool) {
+	if dev, ok := d.registry.Lookup(uuid); ok {
+		return dev, true
+	}
+	select {
+	case d.lookupRefresh <- struct{}{}:
+	case <-ctx.Done():
+		return Device{}, false
+	}
+	defer func() { <-d.lookupRefresh }()
+	// Another lookup may have found the device while this one waited.
+	if dev, ok := d.registry.Lookup(uuid); ok {
+		return dev, true
+	}
+	if d.now().Sub(d.lastLookupRefresh) < minLookupRefresh {
+		return Device{}, false
+	}
+	d.lastLookupRefresh = d.now()
+	d.Refresh(ctx)
+	return d.registry.Lookup(uuid)
+}
+
+// confirmAll registers each of hosts which is an Awair device, checking at
+// most concurrency of them at once.
+func (d *Discoverer) confirmAll(ctx context.Context, source string, hosts []string, concurrency int) {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		if d.policy != nil {
+			if err := d.policy.Check(ctx, host); err != nil {
+				log.Debug().Err(err).Str("source", source).Msg("Skipping discovered host")
+				continue
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d.confirm(ctx, source, host)
+		}(host)
+	}
+	wg.Wait()
+}
+
+// confirm registers host if it's an Awair device.
+func (d *Discoverer) confirm(ctx context.Context, source, host string) {
+	config, err := exporter.FetchConfig(ctx, host, d.opts...)
+	if err != nil {
+		log.Debug().Err(err).Str("source", source).Str("host", host).Msg("Discovered host is not a reachable Awair device")
+		return
+	}
+	if !isAwairConfig(config) {
+		log.Debug().Str("source", source).Str("host", host).Msg("Discovered host is not an Awair device")
+		return
+	}
+	d.registry.Update(Device{
+		UUID:     config.DeviceUUID,
+		Host:     host,
+		Source:   source,
+		Config:   config,
+		LastSeen: d.now(),
+	})
+}
+
+// isAwairConfig reports whether config looks like the response of an Awair
+// device, rather than of some other HTTP server answering with JSON: its
+// device_uuid is "awair-<model>_<serial>", and it reports a firmware version.
+func isAwairConfig(config *exporter.ConfigResponse) bool {
+	model, serial, ok := strings.Cut(config.DeviceUUID, "_")
+	return ok && strings.HasPrefix(model, "awair-") && len(model) > len("awair-") &&
+		serial != "" && config.FirmwareVersion != ""
+}
@@ -0,0 +1,217 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prometheus-awair-exporter/internal/access"
+	"prometheus-awair-exporter/internal/exporter"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func init() {
+	log.Logger = zerolog.Nop()
+}
+
+// testDevice returns a fake Awair device with the given device_uuid, and its
+// host.
+func testDevice(t *testing.T, uuid string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/settings/config/data" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"device_uuid": %q, "wifi_mac": "70:88:6B:00:00:01", "fw_version": "1.4.0"}`, uuid)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+// staticFinder finds the same hosts every time, unless they're changed.
+type staticFinder struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+func (f *staticFinder) Name() string {
+	return "static"
+}
+
+func (f *staticFinder) Find(context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hosts, nil
+}
+
+func TestDiscoverer_Refresh(t *testing.T) {
+	assert := assert.New(t)
+	device := testDevice(t, "awair-element_1")
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "ok"}`)
+	}))
+	defer other.Close()
+
+	registry := NewRegistry()
+	finder := &staticFinder{hosts: []string{
+		device,
+		strings.TrimPrefix(other.URL, "http://"),
+		"127.0.0.1:1",
+	}}
+	d := NewDiscoverer(registry, time.Minute, []Finder{finder}, WithExporterOptions(exporter.WithTimeout(time.Second)))
+	d.Refresh(context.Background())
+
+	devices := registry.Devices()
+	assert.Equal(1, len(devices))
+	assert.Equal("awair-element_1", devices[0].UUID)
+	assert.Equal(device, devices[0].Host)
+	assert.Equal("static", devices[0].Source)
+	assert.Equal("1.4.0", devices[0].Config.FirmwareVersion)
+}
+
+func TestDiscoverer_DeviceMoves(t *testing.T) {
+	assert := assert.New(t)
+	before := testDevice(t, "awair-element_1")
+	after := testDevice(t, "awair-element_1")
+
+	registry := NewRegistry()
+	finder := &staticFinder{hosts: []string{before}}
+	d := NewDiscoverer(registry, time.Minute, []Finder{finder})
+	d.Refresh(context.Background())
+	finder.hosts = []string{after}
+	d.Refresh(context.Background())
+
+	devices := registry.Devices()
+	assert.Equal(1, len(devices))
+	assert.Equal(after, devices[0].Host)
+}
+
+func TestDiscoverer_Expiry(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1000, 0)
+	registry := NewRegistry()
+	finder := &staticFinder{hosts: []string{testDevice(t, "awair-element_1")}}
+	d := NewDiscoverer(registry, time.Minute, []Finder{finder})
+	d.now = func() time.Time { return now }
+	d.Refresh(context.Background())
+
+	finder.hosts = nil
+	now = now.Add(expiryIntervals * time.Minute)
+	d.Refresh(context.Background())
+	assert.Equal(1, len(registry.Devices()))
+
+	now = now.Add(time.Second)
+	d.Refresh(context.Background())
+	assert.Equal(0, len(registry.Devices()))
+}
+
+// slowFinder finds nothing, taking its time as measured by the discoverer's
+// clock.
+type slowFinder struct {
+	advance func()
+}
+
+func (f *slowFinder) Name() string {
+	return "slow"
+}
+
+func (f *slowFinder) Find(context.Context) ([]string, error) {
+	f.advance()
+	return nil, nil
+}
+
+func TestDiscoverer_ExpirySlowRound(t *testing.T) {
+	now := time.Unix(1000, 0)
+	registry := NewRegistry()
+	finder := &staticFinder{hosts: []string{testDevice(t, "awair-element_1")}}
+	slow := &slowFinder{advance: func() { now = now.Add(expiryIntervals*time.Minute + time.Second) }}
+	d := NewDiscoverer(registry, time.Minute, []Finder{finder, slow})
+	d.now = func() time.Time { return now }
+
+	// The device was found in this round, however long the rest of it took.
+	d.Refresh(context.Background())
+	assert.Equal(t, 1, len(registry.Devices()))
+}
+
+func TestDiscoverer_AccessPolicy(t *testing.T) {
+	policy, err := access.NewPolicy(nil, []string{"127.0.0.0/8"})
+	require.Nil(t, err)
+	registry := NewRegistry()
+	finder := &staticFinder{hosts: []string{testDevice(t, "awair-element_1")}}
+	NewDiscoverer(registry, time.Minute, []Finder{finder}, WithAccessPolicy(policy)).Refresh(context.Background())
+	assert.Equal(t, 0, len(registry.Devices()))
+}
+
+func TestDiscoverer_StartStop(t *testing.T) {
+	registry := NewRegistry()
+	finder := &staticFinder{hosts: []string{testDevice(t, "awair-element_1")}}
+	d := NewDiscoverer(registry, time.Hour, []Finder{finder})
+	d.Start(context.Background())
+
+	require.Eventually(t, func() bool {
+		return len(registry.Devices()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	d.Stop()
+}
+
+func TestDiscoverer_Lookup(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1000, 0)
+	registry := NewRegistry()
+	finder := &staticFinder{}
+	d := NewDiscoverer(registry, time.Hour, []Finder{finder})
+	d.now = func() time.Time { return now }
+
+	// Nothing to find.
+	_, ok := d.Lookup(context.Background(), "awair-element_1")
+	assert.False(ok)
+
+	// The device appears, but the last lookup refreshed too recently.
+	finder.mu.Lock()
+	finder.hosts = []string{testDevice(t, "awair-element_1")}
+	finder.mu.Unlock()
+	_, ok = d.Lookup(context.Background(), "awair-element_1")
+	assert.False(ok)
+
+	now = now.Add(minLookupRefresh)
+	dev, ok := d.Lookup(context.Background(), "awair-element_1")
+	assert.True(ok)
+	assert.Equal(finder.hosts[0], dev.Host)
+
+	// Known devices don't need a refresh.
+	finder.mu.Lock()
+	finder.hosts = nil
+	finder.mu.Unlock()
+	_, ok = d.Lookup(context.Background(), "awair-element_1")
+	assert.True(ok)
+}
+
+func TestIsAwairConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config exporter.ConfigResponse
+		want   bool
+	}{
+		{"element", exporter.ConfigResponse{DeviceUUID: "awair-element_1234", FirmwareVersion: "1.4.0"}, true},
+		{"unknown_model", exporter.ConfigResponse{DeviceUUID: "awair-future_1", FirmwareVersion: "0.1.0"}, true},
+		{"empty", exporter.ConfigResponse{}, false},
+		{"no_firmware", exporter.ConfigResponse{DeviceUUID: "awair-element_1234"}, false},
+		{"no_serial", exporter.ConfigResponse{DeviceUUID: "awair-element_", FirmwareVersion: "1.4.0"}, false},
+		{"no_model", exporter.ConfigResponse{DeviceUUID: "awair-_1234", FirmwareVersion: "1.4.0"}, false},
+		{"other_vendor", exporter.ConfigResponse{DeviceUUID: "sensor_1234", FirmwareVersion: "1.4.0"}, false},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			assert.Equal(t, cse.want, isAwairConfig(&cse.config))
+		})
+	}
+}
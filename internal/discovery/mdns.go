@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	stdlog "log"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/rs/zerolog/log"
+)
+
+// Awair devices advertise their local API as an HTTP service, with an
+// instance name like "AWAIR-ELEM-1A2B3C".
+const (
+	DefaultMDNSService     = "_http._tcp"
+	DefaultMDNSDomain      = "local"
+	DefaultMDNSNamePattern = "awair*"
+	DefaultMDNSTimeout     = 5 * time.Second
+)
+
+// MDNSFinder browses mDNS / DNS-SD for services whose instance name matches a
+// pattern.
+type MDNSFinder struct {
+	service string
+	domain  string
+	pattern string
+	timeout time.Duration
+	iface   *net.Interface
+}
+
+// NewMDNSFinder returns an MDNSFinder browsing service in domain for timeout,
+// keeping the instances whose name matches pattern, a case-insensitive glob.
+// If iface is set, only that network interface is browsed.
+func NewMDNSFinder(service, domain, pattern string, timeout time.Duration, iface string) (*MDNSFinder, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid name pattern %q", pattern)
+	}
+	f := &MDNSFinder{
+		service: service,
+		domain:  domain,
+		pattern: pattern,
+		timeout: timeout,
+	}
+	if iface != "" {
+		var err error
+		if f.iface, err = net.InterfaceByName(iface); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *MDNSFinder) Name() string {
+	return "mdns"
+}
+
+// Find returns the address of each matching instance which answers within
+// the timeout.
+func (f *MDNSFinder) Find(ctx context.Context) ([]string, error) {
+	entries := make(chan *mdns.ServiceEntry, 32)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- mdns.QueryContext(ctx, &mdns.QueryParam{
+			Service:     f.service,
+			Domain:      f.domain,
+			Timeout:     f.timeout,
+			Interface:   f.iface,
+			Entries:     entries,
+			DisableIPv6: true,
+			Logger:      stdlog.New(mdnsLogWriter{}, "", 0),
+		})
+		close(entries)
+	}()
+
+	var hosts []string
+	seen := map[string]bool{}
+	for entry := range entries {
+		host, ok := f.host(entry)
+		if !ok || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	if err := <-errs; err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	return hosts, ctx.Err()
+}
+
+// host returns the address to reach entry at, if it's a matching instance.
+func (f *MDNSFinder) host(entry *mdns.ServiceEntry) (string, bool) {
+	instance := strings.TrimSuffix(entry.Name, "."+strings.Trim(f.service, ".")+"."+strings.Trim(f.domain, ".")+".")
+	if ok, _ := path.Match(f.pattern, strings.ToLower(instance)); !ok || entry.AddrV4 == nil {
+		return "", false
+	}
+	ip := entry.AddrV4.String()
+	if entry.Port == 0 || entry.Port == 80 {
+		return ip, true
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(entry.Port)), true
+}
+
+// mdnsLogWriter passes the mdns package's log messages on at debug level, as
+// e.g. failing to listen on IPv6 is expected.
+type mdnsLogWriter struct{}
+
+func (mdnsLogWriter) Write(p []byte) (int, error) {
+	log.Debug().Str("source", "mdns").Msg(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"context"
+	stdlog "log"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+// advertise runs an in-process mDNS responder for an instance of the HTTP
+// service at 127.0.0.1:port.
+func advertise(t *testing.T, instance string, port int) {
+	service, err := mdns.NewMDNSService(instance, DefaultMDNSService, "", "", port, []net.IP{net.IPv4(127, 0, 0, 1)}, nil)
+	require.Nil(t, err)
+	server, err := mdns.NewServer(&mdns.Config{Zone: service, Logger: stdlog.New(mdnsLogWriter{}, "", 0)})
+	if err != nil {
+		t.Skipf("mDNS is unavailable: %v", err)
+	}
+	t.Cleanup(func() { server.Shutdown() })
+}
+
+func TestMDNSFinder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	host := testDevice(t, "awair-element_1")
+	_, portStr, err := net.SplitHostPort(host)
+	require.Nil(err)
+	port, err := strconv.Atoi(portStr)
+	require.Nil(err)
+	advertise(t, "AWAIR-ELEM-1A2B3C", port)
+	// Some other device advertising an HTTP service.
+	advertise(t, "Office Printer", port+1)
+
+	finder, err := NewMDNSFinder(DefaultMDNSService, DefaultMDNSDomain, DefaultMDNSNamePattern, time.Second, "")
+	require.Nil(err)
+	hosts, err := finder.Find(context.Background())
+	require.Nil(err)
+	if len(hosts) == 0 {
+		t.Skip("mDNS responses are not delivered on this network")
+	}
+	assert.Equal([]string{host}, hosts)
+
+	registry := NewRegistry()
+	NewDiscoverer(registry, time.Minute, []Finder{finder}).Refresh(context.Background())
+	d, ok := registry.Lookup("awair-element_1")
+	assert.True(ok)
+	assert.Equal(host, d.Host)
+	assert.Equal("mdns", d.Source)
+}
+
+func TestNewMDNSFinder_Invalid(t *testing.T) {
+	_, err := NewMDNSFinder(DefaultMDNSService, DefaultMDNSDomain, "[", time.Second, "")
+	assert.NotNil(t, err)
+	_, err = NewMDNSFinder(DefaultMDNSService, DefaultMDNSDomain, DefaultMDNSNamePattern, time.Second, "no-such-interface0")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,148 @@
+package discovery
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"prometheus-awair-exporter/internal/exporter"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SourceProbe is the Source of devices which weren't discovered, but answered
+// a probe.
+const SourceProbe = "probe"
+
+// Device is an Awair device found by discovery, or by probing it. Devices are
+// identified by their device_uuid, as their address may change, e.g. on DHCP
+// renewal.
+type Device struct {
+	UUID string
+	// Host is the address the device was last found at.
+	Host string
+	// Source is the name of the finder which last found the device, or
+	// SourceProbe.
+	Source   string
+	Config   *exporter.ConfigResponse
+	LastSeen time.Time
+}
+
+// Discovered reports whether the device was found by discovery.
+func (d Device) Discovered() bool {
+	return d.Source != SourceProbe
+}
+
+// Registry tracks devices by device_uuid, remembering where each was last
+// seen. It outlives discoverers, so a config reload doesn't forget the devices
+// found so far. It implements exporter.DeviceRegistry.
+type Registry struct {
+	mu      sync.Mutex
+	devices map[string]Device
+}
+
+func NewRegistry() *Registry {
+	return &Registry{devices: map[string]Device{}}
+}
+
+// Update records that d was found.
+func (r *Registry) Update(d Device) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, ok := r.devices[d.UUID]
+	r.devices[d.UUID] = d
+	switch {
+	case !ok || !prev.Discovered():
+		log.Info().
+			Str("device_uuid", d.UUID).
+			Str("host", d.Host).
+			Str("source", d.Source).
+			Msg("Discovered Awair device.")
+	case prev.Host != d.Host:
+		log.Info().
+			Str("device_uuid", d.UUID).
+			Str("previous_host", prev.Host).
+			Str("host", d.Host).
+			Msg("Awair device moved.")
+	}
+}
+
+// Observe records that the device with config answered a probe at host. A
+// device which wasn't discovered is registered with SourceProbe.
+func (r *Registry) Observe(host string, config *exporter.ConfigResponse) {
+	if config.DeviceUUID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.devices[config.DeviceUUID]
+	if !ok {
+		d = Device{UUID: config.DeviceUUID, Source: SourceProbe}
+	} else if d.Host != host {
+		log.Info().
+			Str("device_uuid", d.UUID).
+			Str("previous_host", d.Host).
+			Str("host", host).
+			Msg("Awair device moved.")
+	}
+	d.Host, d.Config, d.LastSeen = host, config, time.Now()
+	r.devices[d.UUID] = d
+}
+
+// UUIDOf returns the device_uuid of the device last seen at host.
+func (r *Registry) UUIDOf(host string) (string, bool) {
+	d, ok := r.LookupHost(host)
+	return d.UUID, ok
+}
+
+// Lookup returns the device with the given device_uuid.
+func (r *Registry) Lookup(uuid string) (Device, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.devices[uuid]
+	return d, ok
+}
+
+// LookupHost returns the device last found at host. If several devices were,
+// e.g. because an address was reassigned, the most recently seen one wins.
+func (r *Registry) LookupHost(host string) (Device, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found Device
+	for _, d := range r.devices {
+		if d.Host == host && d.LastSeen.After(found.LastSeen) {
+			found = d
+		}
+	}
+	return found, found.UUID != ""
+}
+
+// Devices returns every device, ordered by device_uuid.
+func (r *Registry) Devices() []Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	devices := make([]Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		devices = append(devices, d)
+	}
+	slices.SortFunc(devices, func(a, b Device) int {
+		return strings.Compare(a.UUID, b.UUID)
+	})
+	return devices
+}
+
+// Expire forgets the devices last seen before t.
+func (r *Registry) Expire(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for uuid, d := range r.devices {
+		if d.LastSeen.Before(t) {
+			log.Info().
+				Str("device_uuid", uuid).
+				Str("host", d.Host).
+				Msg("Forgetting Awair device which is no longer found.")
+			delete(r.devices, uuid)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"prometheus-awair-exporter/internal/exporter"
+
+	"github.com/tj/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+	r := NewRegistry()
+	start := time.Unix(1000, 0)
+
+	r.Update(Device{UUID: "awair-element_2", Host: "10.0.0.2", LastSeen: start})
+	r.Update(Device{UUID: "awair-element_1", Host: "10.0.0.1", LastSeen: start})
+	// DHCP hands the first device a new address, and its old one to another.
+	r.Update(Device{UUID: "awair-element_1", Host: "10.0.0.3", LastSeen: start.Add(time.Minute)})
+	r.Update(Device{UUID: "awair-element_3", Host: "10.0.0.1", LastSeen: start.Add(2 * time.Minute)})
+
+	devices := r.Devices()
+	assert.Equal(3, len(devices))
+	assert.Equal("awair-element_1", devices[0].UUID)
+	assert.Equal("10.0.0.3", devices[0].Host)
+
+	d, ok := r.Lookup("awair-element_1")
+	assert.True(ok)
+	assert.Equal("10.0.0.3", d.Host)
+	d, ok = r.LookupHost("10.0.0.1")
+	assert.True(ok)
+	assert.Equal("awair-element_3", d.UUID)
+	_, ok = r.LookupHost("10.0.0.4")
+	assert.False(ok)
+
+	r.Expire(start.Add(90 * time.Second))
+	devices = r.Devices()
+	assert.Equal(1, len(devices))
+	assert.Equal("awair-element_3", devices[0].UUID)
+	_, ok = r.Lookup("awair-element_2")
+	assert.False(ok)
+}
+
+func TestRegistry_Observe(t *testing.T) {
+	assert := assert.New(t)
+	r := NewRegistry()
+
+	// Devices without a device_uuid aren't tracked.
+	r.Observe("10.0.0.9", &exporter.ConfigResponse{})
+	assert.Equal(0, len(r.Devices()))
+
+	r.Observe("10.0.0.1", &exporter.ConfigResponse{DeviceUUID: "awair-element_1"})
+	uuid, ok := r.UUIDOf("10.0.0.1")
+	assert.True(ok)
+	assert.Equal("awair-element_1", uuid)
+	d, _ := r.Lookup("awair-element_1")
+	assert.Equal(SourceProbe, d.Source)
+	assert.False(d.Discovered())
+
+	// Discovery takes over a probed device, and probing keeps its source.
+	r.Update(Device{UUID: "awair-element_1", Host: "10.0.0.1", Source: "mdns", LastSeen: time.Now()})
+	r.Observe("10.0.0.2", &exporter.ConfigResponse{DeviceUUID: "awair-element_1"})
+	d, _ = r.Lookup("awair-element_1")
+	assert.True(d.Discovered())
+	assert.Equal("10.0.0.2", d.Host)
+	_, ok = r.UUIDOf("10.0.0.1")
+	assert.False(ok)
+}
@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+const (
+	DefaultScanPort        = 80
+	DefaultScanConcurrency = 32
+)
+
+// maxScanHostBits limits a scanned range to 65536 addresses, so a typo like
+// 10.0.0.0/8 doesn't send millions of requests.
+const maxScanHostBits = 16
+
+// ScanFinder sweeps CIDR ranges for networks where mDNS doesn't reach the
+// exporter, offering every address in them as a candidate.
+type ScanFinder struct {
+	prefixes    []netip.Prefix
+	port        int
+	concurrency int
+}
+
+// NewScanFinder returns a ScanFinder for the addresses in cidrs, with devices
+// listening on port. concurrency is how many addresses are checked at once.
+func NewScanFinder(cidrs []string, port, concurrency int) (*ScanFinder, error) {
+	f := &ScanFinder{port: port, concurrency: concurrency}
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		if prefix.Addr().BitLen()-prefix.Bits() > maxScanHostBits {
+			return nil, fmt.Errorf("%s has more than %d addresses", cidr, 1<<maxScanHostBits)
+		}
+		f.prefixes = append(f.prefixes, prefix.Masked())
+	}
+	return f, nil
+}
+
+func (f *ScanFinder) Name() string {
+	return "scan"
+}
+
+// Concurrency is how many of the finder's candidates are confirmed at once.
+func (f *ScanFinder) Concurrency() int {
+	return f.concurrency
+}
+
+// Find returns every address in the ranges, except the network and broadcast
+// addresses of IPv4 subnets.
+func (f *ScanFinder) Find(ctx context.Context) ([]string, error) {
+	var hosts []string
+	seen := map[netip.Addr]bool{}
+	for _, prefix := range f.prefixes {
+		first, last := prefix.Addr(), lastAddr(prefix)
+		if prefix.Addr().Is4() && prefix.Bits() < 31 {
+			first, last = first.Next(), last.Prev()
+		}
+		for addr := first; addr.IsValid() && addr.Compare(last) <= 0; addr = addr.Next() {
+			if !seen[addr] {
+				seen[addr] = true
+				hosts = append(hosts, f.host(addr))
+			}
+		}
+	}
+	return hosts, ctx.Err()
+}
+
+func (f *ScanFinder) host(addr netip.Addr) string {
+	if f.port == 80 {
+		return addr.String()
+	}
+	return net.JoinHostPort(addr.String(), strconv.Itoa(f.port))
+}
+
+// lastAddr returns the last address of prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"prometheus-awair-exporter/internal/exporter"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func TestScanFinder_Find(t *testing.T) {
+	cases := []struct {
+		name  string
+		cidrs []string
+		port  int
+		want  []string
+	}{
+		{"subnet", []string{"192.168.0.0/29"}, 80, []string{
+			"192.168.0.1", "192.168.0.2", "192.168.0.3", "192.168.0.4", "192.168.0.5", "192.168.0.6",
+		}},
+		{"single_address", []string{"192.168.0.7/32"}, 80, []string{"192.168.0.7"}},
+		{"point_to_point", []string{"10.0.0.0/31"}, 80, []string{"10.0.0.0", "10.0.0.1"}},
+		{"unmasked", []string{"10.0.0.5/30"}, 80, []string{"10.0.0.5", "10.0.0.6"}},
+		{"overlapping", []string{"10.0.0.0/30", "10.0.0.2/32"}, 80, []string{"10.0.0.1", "10.0.0.2"}},
+		{"port", []string{"10.0.0.0/30"}, 8080, []string{"10.0.0.1:8080", "10.0.0.2:8080"}},
+		{"ipv6", []string{"fd00::/127"}, 80, []string{"fd00::", "fd00::1"}},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			f, err := NewScanFinder(cse.cidrs, cse.port, 1)
+			require.Nil(t, err)
+			hosts, err := f.Find(context.Background())
+			require.Nil(t, err)
+			assert.Equal(t, cse.want, hosts)
+		})
+	}
+}
+
+func TestNewScanFinder_Invalid(t *testing.T) {
+	_, err := NewScanFinder([]string{"192.168.0.0"}, 80, 1)
+	assert.NotNil(t, err)
+	_, err = NewScanFinder([]string{"10.0.0.0/8"}, 80, 1)
+	require.NotNil(t, err)
+	assert.Equal(t, "10.0.0.0/8 has more than 65536 addresses", err.Error())
+}
+
+func TestScanFinder_Discovers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	host := testDevice(t, "awair-element_1")
+	_, port, err := net.SplitHostPort(host)
+	require.Nil(err)
+	portNum, err := strconv.Atoi(port)
+	require.Nil(err)
+
+	// Only 127.0.0.1 answers, the rest of the range refuses connections.
+	f, err := NewScanFinder([]string{"127.0.0.0/29"}, portNum, 4)
+	require.Nil(err)
+	registry := NewRegistry()
+	NewDiscoverer(registry, time.Minute, []Finder{f}, WithExporterOptions(exporter.WithTimeout(time.Second))).Refresh(context.Background())
+
+	devices := registry.Devices()
+	require.Equal(1, len(devices))
+	assert.Equal("awair-element_1", devices[0].UUID)
+	assert.Equal(host, devices[0].Host)
+	assert.Equal("scan", devices[0].Source)
+}
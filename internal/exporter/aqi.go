@@ -0,0 +1,240 @@
+package exporter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	aqi = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "aqi"),
+		"Air Quality Index of the pollutant under the standard, computed from the latest reading",
+		[]string{"standard", "pollutant"},
+		nil,
+	)
+
+	aqi_category = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "aqi_category"),
+		"Air Quality Index category of the pollutant under the standard (1 for the current category)",
+		[]string{"standard", "pollutant", "category"},
+		nil,
+	)
+)
+
+// AQIStandard selects how an Air Quality Index is computed from particulate
+// matter concentrations.
+type AQIStandard string
+
+const (
+	// AQIUSEPA is the US EPA's AQI, with the PM2.5 breakpoints revised in 2024.
+	AQIUSEPA AQIStandard = "us_epa"
+	// AQIUSEPA2012 is the US EPA's AQI with the PM2.5 breakpoints in use from
+	// 2012 to 2024.
+	AQIUSEPA2012 AQIStandard = "us_epa_2012"
+	// AQIEUCAQI is the European Common Air Quality Index, for hourly readings
+	// away from traffic.
+	AQIEUCAQI AQIStandard = "eu_caqi"
+	// AQIIndiaNAQI is India's National Air Quality Index.
+	AQIIndiaNAQI AQIStandard = "in_naqi"
+)
+
+// AQIStandards lists every AQI standard.
+var AQIStandards = []AQIStandard{AQIUSEPA, AQIUSEPA2012, AQIEUCAQI, AQIIndiaNAQI}
+
+// ParseAQIStandard returns the AQI standard called s.
+func ParseAQIStandard(s string) (AQIStandard, error) {
+	names := make([]string, len(AQIStandards))
+	for i, standard := range AQIStandards {
+		if string(standard) == s {
+			return standard, nil
+		}
+		names[i] = string(standard)
+	}
+	return "", fmt.Errorf("unknown AQI standard %q, must be one of %s", s, strings.Join(names, ", "))
+}
+
+// aqiBand maps the concentrations from cLo to cHi (µg/m³) linearly onto the
+// index values from iLo to iHi. The last band of a scale may be open-ended,
+// with an infinite cHi.
+type aqiBand struct {
+	cLo, cHi float64
+	iLo, iHi float64
+	category string
+}
+
+// aqiScale computes the index of one pollutant.
+type aqiScale struct {
+	// precision is the step concentrations are truncated to before they're
+	// looked up, as the standard's breakpoints have gaps of that size.
+	precision float64
+	bands     []aqiBand
+}
+
+// index returns the index for concentration c, rounded to the nearest integer,
+// and its category. Concentrations in an open-ended last band are
+// extrapolated at the rate of the band below, up to the band's iHi; those
+// beyond the last closed band get its iHi.
+func (s aqiScale) index(c float64) (float64, string) {
+	if s.precision > 0 {
+		c = math.Floor(c/s.precision+1e-9) * s.precision
+	}
+	c = math.Max(c, 0)
+	for i, b := range s.bands {
+		if c > b.cHi {
+			continue
+		}
+		if math.IsInf(b.cHi, 1) {
+			prev := s.bands[i-1]
+			slope := (prev.iHi - prev.iLo) / (prev.cHi - prev.cLo)
+			return math.Min(math.Round(b.iLo+(c-b.cLo)*slope), b.iHi), b.category
+		}
+		return math.Round(b.iLo + (b.iHi-b.iLo)/(b.cHi-b.cLo)*(c-b.cLo)), b.category
+	}
+	last := s.bands[len(s.bands)-1]
+	return last.iHi, last.category
+}
+
+// aqiScheme is the scale of each pollutant of a standard, and its categories
+// from best to worst.
+type aqiScheme struct {
+	categories []string
+	pm25, pm10 aqiScale
+}
+
+var usEPACategories = []string{
+	"good",
+	"moderate",
+	"unhealthy_for_sensitive_groups",
+	"unhealthy",
+	"very_unhealthy",
+	"hazardous",
+}
+
+var aqiSchemes = map[AQIStandard]aqiScheme{
+	AQIUSEPA: {
+		categories: usEPACategories,
+		pm25: aqiScale{precision: 0.1, bands: []aqiBand{
+			{0, 9.0, 0, 50, "good"},
+			{9.1, 35.4, 51, 100, "moderate"},
+			{35.5, 55.4, 101, 150, "unhealthy_for_sensitive_groups"},
+			{55.5, 125.4, 151, 200, "unhealthy"},
+			{125.5, 225.4, 201, 300, "very_unhealthy"},
+			{225.5, 325.4, 301, 500, "hazardous"},
+		}},
+		// 2024 merged the hazardous PM10 bands without moving them.
+		pm10: aqiScale{precision: 1, bands: []aqiBand{
+			{0, 54, 0, 50, "good"},
+			{55, 154, 51, 100, "moderate"},
+			{155, 254, 101, 150, "unhealthy_for_sensitive_groups"},
+			{255, 354, 151, 200, "unhealthy"},
+			{355, 424, 201, 300, "very_unhealthy"},
+			{425, 604, 301, 500, "hazardous"},
+		}},
+	},
+	AQIUSEPA2012: {
+		categories: usEPACategories,
+		pm25: aqiScale{precision: 0.1, bands: []aqiBand{
+			{0, 12.0, 0, 50, "good"},
+			{12.1, 35.4, 51, 100, "moderate"},
+			{35.5, 55.4, 101, 150, "unhealthy_for_sensitive_groups"},
+			{55.5, 150.4, 151, 200, "unhealthy"},
+			{150.5, 250.4, 201, 300, "very_unhealthy"},
+			{250.5, 350.4, 301, 400, "hazardous"},
+			{350.5, 500.4, 401, 500, "hazardous"},
+		}},
+		pm10: aqiScale{precision: 1, bands: []aqiBand{
+			{0, 54, 0, 50, "good"},
+			{55, 154, 51, 100, "moderate"},
+			{155, 254, 101, 150, "unhealthy_for_sensitive_groups"},
+			{255, 354, 151, 200, "unhealthy"},
+			{355, 424, 201, 300, "very_unhealthy"},
+			{425, 504, 301, 400, "hazardous"},
+			{505, 604, 401, 500, "hazardous"},
+		}},
+	},
+	AQIEUCAQI: {
+		categories: []string{"very_low", "low", "medium", "high", "very_high"},
+		pm25: aqiScale{bands: []aqiBand{
+			{0, 15, 0, 25, "very_low"},
+			{15, 30, 25, 50, "low"},
+			{30, 55, 50, 75, "medium"},
+			{55, 110, 75, 100, "high"},
+			{110, math.Inf(1), 100, math.Inf(1), "very_high"},
+		}},
+		pm10: aqiScale{bands: []aqiBand{
+			{0, 25, 0, 25, "very_low"},
+			{25, 50, 25, 50, "low"},
+			{50, 90, 50, 75, "medium"},
+			{90, 180, 75, 100, "high"},
+			{180, math.Inf(1), 100, math.Inf(1), "very_high"},
+		}},
+	},
+	AQIIndiaNAQI: {
+		categories: []string{"good", "satisfactory", "moderate", "poor", "very_poor", "severe"},
+		pm25: aqiScale{precision: 1, bands: []aqiBand{
+			{0, 30, 0, 50, "good"},
+			{31, 60, 51, 100, "satisfactory"},
+			{61, 90, 101, 200, "moderate"},
+			{91, 120, 201, 300, "poor"},
+			{121, 250, 301, 400, "very_poor"},
+			{251, math.Inf(1), 401, 500, "severe"},
+		}},
+		pm10: aqiScale{precision: 1, bands: []aqiBand{
+			{0, 50, 0, 50, "good"},
+			{51, 100, 51, 100, "satisfactory"},
+			{101, 250, 101, 200, "moderate"},
+			{251, 350, 201, 300, "poor"},
+			{351, 430, 301, 400, "very_poor"},
+			{431, math.Inf(1), 401, 500, "severe"},
+		}},
+	},
+}
+
+// AQIPM25 returns the index of the PM2.5 concentration pm25 (µg/m³) under
+// standard, and its category.
+func AQIPM25(standard AQIStandard, pm25 float64) (float64, string) {
+	return aqiSchemes[standard].pm25.index(pm25)
+}
+
+// AQIPM10 returns the index of the PM10 concentration pm10 (µg/m³) under
+// standard, and its category.
+func AQIPM10(standard AQIStandard, pm10 float64) (float64, string) {
+	return aqiSchemes[standard].pm10.index(pm10)
+}
+
+// WithAQIStandards exports the Air Quality Index of the particulate matter
+// readings under each of standards.
+func WithAQIStandards(standards ...AQIStandard) Option {
+	return func(e *AwairExporter) {
+		e.aqiStandards = standards
+	}
+}
+
+// collectAQI emits the index and category of each particulate matter reading
+// under each of the exporter's standards, using gauge to build the metrics.
+func (e *AwairExporter) collectAQI(ch chan<- prometheus.Metric, values *AwairValues, gauge func(*prometheus.Desc, float64, ...string) prometheus.Metric) {
+	pollutants := []struct {
+		name  string
+		value *float64
+		scale func(aqiScheme) aqiScale
+	}{
+		{"pm25", values.PM25, func(s aqiScheme) aqiScale { return s.pm25 }},
+		{"pm10", values.PM10Est, func(s aqiScheme) aqiScale { return s.pm10 }},
+	}
+	for _, standard := range e.aqiStandards {
+		scheme := aqiSchemes[standard]
+		for _, p := range pollutants {
+			if p.value == nil {
+				continue
+			}
+			index, current := p.scale(scheme).index(*p.value)
+			ch <- gauge(aqi, index, string(standard), p.name)
+			for _, category := range scheme.categories {
+				ch <- gauge(aqi_category, boolToFloat(category == current), string(standard), p.name, category)
+			}
+		}
+	}
+}
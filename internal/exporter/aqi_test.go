@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func TestAQIPM25(t *testing.T) {
+	cases := []struct {
+		standard AQIStandard
+		pm25     float64
+		want     float64
+		category string
+	}{
+		// The 2024 breakpoints lowered the top of "good" from 12.0 to 9.0.
+		{AQIUSEPA, 0, 0, "good"},
+		{AQIUSEPA, 9.0, 50, "good"},
+		{AQIUSEPA, 9.09, 50, "good"},
+		{AQIUSEPA, 12.0, 56, "moderate"},
+		{AQIUSEPA, 35.0, 99, "moderate"},
+		{AQIUSEPA, 55.5, 151, "unhealthy"},
+		{AQIUSEPA, 100, 182, "unhealthy"},
+		{AQIUSEPA, 325.4, 500, "hazardous"},
+		{AQIUSEPA, 900, 500, "hazardous"},
+		{AQIUSEPA2012, 12.0, 50, "good"},
+		{AQIUSEPA2012, 35.0, 99, "moderate"},
+		{AQIUSEPA2012, 100, 174, "unhealthy"},
+		{AQIUSEPA2012, 300, 350, "hazardous"},
+		{AQIEUCAQI, 10, 17, "very_low"},
+		{AQIEUCAQI, 20, 33, "low"},
+		{AQIEUCAQI, 110, 100, "high"},
+		{AQIEUCAQI, 120, 105, "very_high"},
+		{AQIIndiaNAQI, 30, 50, "good"},
+		{AQIIndiaNAQI, 45, 75, "satisfactory"},
+		{AQIIndiaNAQI, 100, 232, "poor"},
+		{AQIIndiaNAQI, 300, 439, "severe"},
+		{AQIIndiaNAQI, 1000, 500, "severe"},
+	}
+	for _, cse := range cases {
+		t.Run(fmt.Sprintf("%s_%v", cse.standard, cse.pm25), func(t *testing.T) {
+			got, category := AQIPM25(cse.standard, cse.pm25)
+			assert.Equal(t, cse.want, got)
+			assert.Equal(t, cse.category, category)
+		})
+	}
+}
+
+func TestAQIPM10(t *testing.T) {
+	cases := []struct {
+		standard AQIStandard
+		pm10     float64
+		want     float64
+		category string
+	}{
+		{AQIUSEPA, 50, 46, "good"},
+		{AQIUSEPA, 54.9, 50, "good"},
+		{AQIUSEPA, 154, 100, "moderate"},
+		{AQIUSEPA, 155, 101, "unhealthy_for_sensitive_groups"},
+		{AQIUSEPA, 505, 390, "hazardous"},
+		{AQIUSEPA2012, 505, 401, "hazardous"},
+		{AQIEUCAQI, 40, 40, "low"},
+		{AQIEUCAQI, 135, 88, "high"},
+		{AQIIndiaNAQI, 80, 80, "satisfactory"},
+		{AQIIndiaNAQI, 300, 250, "poor"},
+	}
+	for _, cse := range cases {
+		t.Run(fmt.Sprintf("%s_%v", cse.standard, cse.pm10), func(t *testing.T) {
+			got, category := AQIPM10(cse.standard, cse.pm10)
+			assert.Equal(t, cse.want, got)
+			assert.Equal(t, cse.category, category)
+		})
+	}
+}
+
+func TestParseAQIStandard(t *testing.T) {
+	assert := assert.New(t)
+	for _, standard := range AQIStandards {
+		got, err := ParseAQIStandard(string(standard))
+		assert.Nil(err)
+		assert.Equal(standard, got)
+		_, ok := aqiSchemes[standard]
+		assert.True(ok, standard)
+	}
+	_, err := ParseAQIStandard("us")
+	assert.NotNil(err)
+}
+
+func TestIsReservedLabel_AQI(t *testing.T) {
+	// Reserved even when no standard is enabled, as modules can enable them.
+	for _, name := range []string{"standard", "pollutant", "category"} {
+		assert.True(t, IsReservedLabel(name), name)
+	}
+}
+
+func TestCollect_AQI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			fmt.Fprint(w, `{"device_uuid": "awair-element_1"}`)
+		case "/air-data/latest":
+			fmt.Fprint(w, `{"pm25": 35, "pm10_est": 50}`)
+		}
+	}))
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	// Off by default.
+	got := gatherCollector(t, newAwairExporter(hostname))
+	assert.NotContains(t, got, "awair_aqi")
+	assert.NotContains(t, got, "awair_aqi_category")
+
+	got = gatherCollector(t, newAwairExporter(hostname, WithAQIStandards(AQIUSEPA, AQIEUCAQI)))
+	require.Contains(t, got, "awair_aqi")
+	indices := map[string]float64{}
+	for _, m := range got["awair_aqi"].GetMetric() {
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		indices[labels["standard"]+"/"+labels["pollutant"]] = m.GetGauge().GetValue()
+	}
+	assert.Equal(t, map[string]float64{
+		"us_epa/pm25":  99,
+		"us_epa/pm10":  46,
+		"eu_caqi/pm25": 55,
+		"eu_caqi/pm10": 50,
+	}, indices)
+
+	require.Contains(t, got, "awair_aqi_category")
+	current := map[string]string{}
+	for _, m := range got["awair_aqi_category"].GetMetric() {
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if m.GetGauge().GetValue() == 1 {
+			key := labels["standard"] + "/" + labels["pollutant"]
+			assert.NotContains(t, current, key)
+			current[key] = labels["category"]
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"us_epa/pm25":  "moderate",
+		"us_epa/pm10":  "good",
+		"eu_caqi/pm25": "medium",
+		"eu_caqi/pm10": "low",
+	}, current)
+	// A series for every category of each standard and pollutant.
+	assert.Equal(t, 2*len(usEPACategories)+2*len(aqiSchemes[AQIEUCAQI].categories), len(got["awair_aqi_category"].GetMetric()))
+}
@@ -0,0 +1,131 @@
+package exporter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Awair devices run a small embedded HTTP server on a Wi-Fi module, which
+// copes poorly with many concurrent or freshly opened connections. These
+// settings keep a couple of connections per device alive between scrapes
+// and fail fast when a device isn't reachable.
+const (
+	dialTimeout         = 3 * time.Second
+	dialKeepAlive       = 30 * time.Second
+	tlsHandshakeTimeout = 5 * time.Second
+	idleConnTimeout     = 90 * time.Second
+	maxConnsPerHost     = 2
+	maxIdleConns        = 100
+)
+
+var defaultClient = NewHTTPClient()
+
+// NewHTTPClient returns an http.Client tuned for talking to Awair devices.
+// A single client should be shared by every exporter so connections to a
+// device are reused across probes.
+func NewHTTPClient() *http.Client {
+	return NewHTTPClientWithTLS(nil)
+}
+
+// NewHTTPClientWithTLS is like NewHTTPClient, using tlsConfig for targets
+// reached over HTTPS.
+func NewHTTPClientWithTLS(tlsConfig *tls.Config) *http.Client {
+	return newHTTPClient(tlsConfig, maxConnsPerHost)
+}
+
+// NewProxyHTTPClient is like NewHTTPClientWithTLS, for devices reached through
+// a reverse proxy. Every device behind a proxy shares its host, so the
+// connections to a host aren't limited; give each device its own client to
+// limit the connections to it.
+func NewProxyHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return newHTTPClient(tlsConfig, 0)
+}
+
+// RestrictHTTPClient returns a copy of client, which must have been returned
+// by this package, only connecting to the addresses check allows. check is
+// called with the host being dialed and each address it resolved to, right
+// before connecting, so a host can't pass an earlier check and then resolve
+// somewhere else. The copy doesn't use a proxy, as the proxy would connect to
+// addresses check never sees.
+func RestrictHTTPClient(client *http.Client, check func(host string, addr netip.Addr) error) *http.Client {
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		dialer := &net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: dialKeepAlive,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return err
+				}
+				return check(host, addrPort.Addr())
+			},
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+	restricted := *client
+	restricted.Transport = transport
+	return &restricted
+}
+
+// newHTTPClient returns a client allowing up to maxConns connections per host,
+// or any number if 0.
+func newHTTPClient(tlsConfig *tls.Config, maxConns int) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: dialKeepAlive,
+	}
+	maxIdleConnsPerHost := maxConns
+	if maxConns == 0 {
+		maxIdleConnsPerHost = maxIdleConns
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: tlsHandshakeTimeout,
+			IdleConnTimeout:     idleConnTimeout,
+			MaxIdleConns:        maxIdleConns,
+			MaxIdleConnsPerHost: maxIdleConnsPerHost,
+			MaxConnsPerHost:     maxConns,
+		},
+		// Devices don't redirect, and following a redirect would send the
+		// request to a host which was never checked against the access rules.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// LoadTLSConfig returns the TLS settings for reaching a device over HTTPS,
+// usually through a reverse proxy. If caFile is set, only the CAs in it are
+// trusted rather than the system's.
+func LoadTLSConfig(caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM encoded certificates found", caFile)
+	}
+	return config, nil
+}
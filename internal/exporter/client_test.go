@@ -0,0 +1,178 @@
+package exporter
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func TestNewHTTPClient_ReusesConnections(t *testing.T) {
+	require := require.New(t)
+	var conns int32
+	srv := httptest.NewUnstartedServer(testDeviceHandler())
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	client := NewHTTPClient()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+	for i := 0; i < 5; i++ {
+		e, err := NewAwairExporter(hostname, WithHTTPClient(client))
+		require.Nil(err)
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(e)
+		_, err = reg.Gather()
+		require.Nil(err)
+	}
+	assert.LessOrEqual(t, int(atomic.LoadInt32(&conns)), maxConnsPerHost)
+}
+
+func TestNewHTTPClient_LimitsConnsPerHost(t *testing.T) {
+	transport, ok := NewHTTPClient().Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, maxConnsPerHost, transport.MaxConnsPerHost)
+	assert.Equal(t, maxConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.NotZero(t, transport.IdleConnTimeout)
+	assert.NotZero(t, transport.TLSHandshakeTimeout)
+}
+
+func TestNewProxyHTTPClient_DoesNotLimitConnsPerHost(t *testing.T) {
+	transport, ok := NewProxyHTTPClient(nil).Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 0, transport.MaxConnsPerHost)
+	assert.Equal(t, maxIdleConns, transport.MaxIdleConnsPerHost)
+}
+
+// writeServerCA writes the certificate of a TLS test server to a file, for
+// use as a CA bundle.
+func writeServerCA(t *testing.T, srv *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.Nil(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestGetMetrics_HTTPSProxy(t *testing.T) {
+	// A reverse proxy serving the device under /awair/office, behind auth.
+	proxy := http.NewServeMux()
+	proxy.Handle("/awair/office/", http.StripPrefix("/awair/office", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if (ok && user == "prometheus" && password == "s3cret") || r.Header.Get("Authorization") == "Bearer t0ken" {
+			testDeviceHandler().ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	})))
+	srv := httptest.NewTLSServer(proxy)
+	defer srv.Close()
+	caFile := writeServerCA(t, srv)
+
+	trusted, err := LoadTLSConfig(caFile, false)
+	require.Nil(t, err)
+	untrusted, err := LoadTLSConfig("", false)
+	require.Nil(t, err)
+	insecure, err := LoadTLSConfig("", true)
+	require.Nil(t, err)
+
+	cases := []struct {
+		name string
+		url  string
+		opts []Option
+		ok   bool
+	}{
+		{"basic_auth", srv.URL + "/awair/office", []Option{WithHTTPClient(NewHTTPClientWithTLS(trusted)), WithBasicAuth("prometheus", "s3cret")}, true},
+		{"trailing_slash", srv.URL + "/awair/office/", []Option{WithHTTPClient(NewHTTPClientWithTLS(trusted)), WithBasicAuth("prometheus", "s3cret")}, true},
+		{"bearer_token", srv.URL + "/awair/office", []Option{WithHTTPClient(NewHTTPClientWithTLS(trusted)), WithBearerToken("t0ken")}, true},
+		{"insecure_skip_verify", srv.URL + "/awair/office", []Option{WithHTTPClient(NewHTTPClientWithTLS(insecure)), WithBearerToken("t0ken")}, true},
+		{"wrong_password", srv.URL + "/awair/office", []Option{WithHTTPClient(NewHTTPClientWithTLS(trusted)), WithBasicAuth("prometheus", "guess")}, false},
+		{"no_auth", srv.URL + "/awair/office", []Option{WithHTTPClient(NewHTTPClientWithTLS(trusted))}, false},
+		{"untrusted_ca", srv.URL + "/awair/office", []Option{WithHTTPClient(NewHTTPClientWithTLS(untrusted)), WithBearerToken("t0ken")}, false},
+		{"wrong_prefix", srv.URL + "/awair/kitchen", []Option{WithHTTPClient(NewHTTPClientWithTLS(trusted)), WithBearerToken("t0ken")}, false},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			e := newAwairExporter(cse.url, cse.opts...)
+			values, err := e.GetMetrics(context.Background())
+			if !cse.ok {
+				assert.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, ptr(89), values.Score)
+			_, err = e.GetConfig(context.Background())
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestLoadTLSConfig_Invalid(t *testing.T) {
+	_, err := LoadTLSConfig(filepath.Join(t.TempDir(), "missing.pem"), false)
+	assert.NotNil(t, err)
+
+	path := filepath.Join(t.TempDir(), "empty.pem")
+	require.Nil(t, os.WriteFile(path, []byte("not a certificate"), 0o600))
+	_, err = LoadTLSConfig(path, false)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no PEM encoded certificates")
+}
+
+func TestNewHTTPClient_DoesNotFollowRedirects(t *testing.T) {
+	var followed int32
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&followed, 1)
+	}))
+	defer elsewhere.Close()
+	srv := httptest.NewServer(http.RedirectHandler(elsewhere.URL+"/latest/meta-data", http.StatusFound))
+	defer srv.Close()
+
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+	_, err := newAwairExporter(hostname).GetMetrics(context.Background())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "302 Found")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&followed))
+}
+
+func TestRestrictHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(testDeviceHandler())
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	require.Nil(t, err)
+
+	var checked []string
+	deny := errors.New("denied")
+	client := RestrictHTTPClient(NewHTTPClient(), func(host string, addr netip.Addr) error {
+		checked = append(checked, host+"="+addr.String())
+		if addr.IsLoopback() && host != "127.0.0.1" {
+			return deny
+		}
+		return nil
+	})
+
+	// The address connected to is checked, along with the host it's for.
+	_, err = newAwairExporter(net.JoinHostPort("127.0.0.1", port), WithHTTPClient(client)).GetMetrics(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"127.0.0.1=127.0.0.1"}, checked)
+
+	checked = nil
+	_, err = newAwairExporter(net.JoinHostPort("localhost", port), WithHTTPClient(client)).GetMetrics(context.Background())
+	require.NotNil(t, err)
+	assert.True(t, errors.Is(err, deny), err)
+	assert.NotEmpty(t, checked)
+}
@@ -0,0 +1,145 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultConfigCacheTTL is how long a device's config is reused before it is
+// fetched again.
+const DefaultConfigCacheTTL = 5 * time.Minute
+
+type configCacheEntry struct {
+	config  *ConfigResponse
+	fetched time.Time
+	// ttl is how long the entry was cached for when it was fetched.
+	ttl time.Duration
+}
+
+func (e configCacheEntry) expired(now time.Time) bool {
+	return now.Sub(e.fetched) >= e.ttl
+}
+
+// ConfigCache remembers the /settings/config/data response of each target so
+// a scrape only needs to request /air-data/latest in the common case.
+//
+// Entries expire after the TTL, and are dropped once expired or as soon as any
+// request to the device fails. A firmware update reboots the device, so this also picks up
+// the new firmware version on the next successful scrape.
+//
+// ConfigCache implements prometheus.Collector, exporting its hit and miss
+// counters.
+type ConfigCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]configCacheEntry
+
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+func NewConfigCache(ttl time.Duration) *ConfigCache {
+	return &ConfigCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]configCacheEntry{},
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "awair_exporter",
+			Name:      "config_cache_hits_total",
+			Help:      "Number of device config lookups served from the cache",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "awair_exporter",
+			Name:      "config_cache_misses_total",
+			Help:      "Number of device config lookups which required a request to the device",
+		}),
+	}
+}
+
+// Get returns the cached config for target, calling fetch if there is no
+// fresh entry.
+func (c *ConfigCache) Get(ctx context.Context, target string, fetch func(context.Context) (*ConfigResponse, error)) (*ConfigResponse, error) {
+	return c.GetWithTTL(ctx, target, c.ttl, fetch)
+}
+
+// GetWithTTL is like Get, but entries are only fresh for ttl rather than the
+// cache's own TTL.
+func (c *ConfigCache) GetWithTTL(ctx context.Context, target string, ttl time.Duration, fetch func(context.Context) (*ConfigResponse, error)) (*ConfigResponse, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[target]
+	if ok && c.now().Sub(entry.fetched) < ttl {
+		c.mu.Unlock()
+		c.hits.Inc()
+		return entry.config, nil
+	}
+	c.mu.Unlock()
+	c.misses.Inc()
+
+	config, err := fetch(ctx)
+	if err != nil {
+		c.Invalidate(target)
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ok && entry.config.FirmwareVersion != config.FirmwareVersion {
+		log.Info().
+			Str("target", target).
+			Str("previous_firmware_version", entry.config.FirmwareVersion).
+			Str("firmware_version", config.FirmwareVersion).
+			Msg("Awair device firmware changed.")
+	}
+	c.entries[target] = configCacheEntry{config: config, fetched: c.now(), ttl: ttl}
+	// Drop the entries of targets which stopped being probed, e.g. one-off
+	// probes of ad-hoc targets, so they don't pile up.
+	c.evict()
+	return config, nil
+}
+
+// evict drops the expired entries. c.mu must be held.
+func (c *ConfigCache) evict() {
+	now := c.now()
+	for target, entry := range c.entries {
+		if entry.expired(now) {
+			delete(c.entries, target)
+		}
+	}
+}
+
+// Invalidate drops the cached config for target, forcing the next Get to
+// fetch it from the device.
+func (c *ConfigCache) Invalidate(target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, target)
+}
+
+// Entries returns the fresh cached config of each target. As entries are
+// dropped when a request to the device fails, these are the targets which
+// answered their last scrape, within the TTL.
+func (c *ConfigCache) Entries() map[string]*ConfigResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+	entries := make(map[string]*ConfigResponse, len(c.entries))
+	for target, entry := range c.entries {
+		entries[target] = entry.config
+	}
+	return entries
+}
+
+func (c *ConfigCache) Describe(ch chan<- *prometheus.Desc) {
+	c.hits.Describe(ch)
+	c.misses.Describe(ch)
+}
+
+func (c *ConfigCache) Collect(ch chan<- prometheus.Metric) {
+	c.hits.Collect(ch)
+	c.misses.Collect(ch)
+}
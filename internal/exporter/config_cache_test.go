@@ -0,0 +1,208 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+// countingServer wraps a fake Awair device, counting requests per path.
+type countingServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newCountingServer(handler http.Handler) *countingServer {
+	s := &countingServer{counts: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.counts[r.URL.Path]++
+		s.mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+func (s *countingServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[path]
+}
+
+func TestConfigCache_OneAirDataRequestPerScrape(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := newCountingServer(testDeviceHandler())
+	defer srv.Close()
+
+	cache := NewConfigCache(time.Hour)
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+	for i := 0; i < 3; i++ {
+		e, err := NewAwairExporter(hostname, WithConfigCache(cache))
+		require.Nil(err)
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(e)
+		_, err = reg.Gather()
+		require.Nil(err)
+	}
+
+	assert.Equal(1, srv.count("/settings/config/data"))
+	assert.Equal(3, srv.count("/air-data/latest"))
+	assert.Equal(float64(5), testutil.ToFloat64(cache.hits))
+	assert.Equal(float64(1), testutil.ToFloat64(cache.misses))
+}
+
+func TestConfigCache_Expiry(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1000, 0)
+	cache := NewConfigCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	fetches := 0
+	fetch := func(context.Context) (*ConfigResponse, error) {
+		fetches++
+		return &ConfigResponse{FirmwareVersion: "1.0.0"}, nil
+	}
+
+	_, err := cache.Get(context.Background(), "a", fetch)
+	assert.Nil(err)
+	now = now.Add(30 * time.Second)
+	_, err = cache.Get(context.Background(), "a", fetch)
+	assert.Nil(err)
+	assert.Equal(1, fetches)
+
+	now = now.Add(time.Minute)
+	_, err = cache.Get(context.Background(), "a", fetch)
+	assert.Nil(err)
+	assert.Equal(2, fetches)
+
+	_, err = cache.Get(context.Background(), "b", fetch)
+	assert.Nil(err)
+	assert.Equal(3, fetches)
+}
+
+func TestConfigCache_FetchErrorNotCached(t *testing.T) {
+	assert := assert.New(t)
+	cache := NewConfigCache(time.Hour)
+
+	fetches := 0
+	fetch := func(context.Context) (*ConfigResponse, error) {
+		fetches++
+		if fetches == 1 {
+			return nil, errors.New("boom")
+		}
+		return &ConfigResponse{}, nil
+	}
+
+	_, err := cache.Get(context.Background(), "a", fetch)
+	assert.NotNil(err)
+	_, err = cache.Get(context.Background(), "a", fetch)
+	assert.Nil(err)
+	assert.Equal(2, fetches)
+}
+
+func TestConfigCache_InvalidatedOnScrapeFailure(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := newCountingServer(testDeviceHandler("/air-data/latest"))
+	defer srv.Close()
+
+	cache := NewConfigCache(time.Hour)
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+	e, err := NewAwairExporter(hostname, WithConfigCache(cache))
+	require.Nil(err)
+
+	for i := 0; i < 2; i++ {
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(e)
+		_, err = reg.Gather()
+		require.Nil(err)
+	}
+	// One request from the constructor, then every failed scrape drops the
+	// entry so the next scrape has to fetch it again.
+	assert.Equal(2, srv.count("/settings/config/data"))
+}
+
+func TestConfigCache_GetWithTTL(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1000, 0)
+	cache := NewConfigCache(time.Hour)
+	cache.now = func() time.Time { return now }
+
+	fetches := 0
+	fetch := func(context.Context) (*ConfigResponse, error) {
+		fetches++
+		return &ConfigResponse{}, nil
+	}
+
+	_, err := cache.Get(context.Background(), "a", fetch)
+	assert.Nil(err)
+	now = now.Add(2 * time.Minute)
+	_, err = cache.GetWithTTL(context.Background(), "a", time.Minute, fetch)
+	assert.Nil(err)
+	assert.Equal(2, fetches)
+
+	_, err = cache.Get(context.Background(), "a", fetch)
+	assert.Nil(err)
+	_, err = cache.GetWithTTL(context.Background(), "a", 0, fetch)
+	assert.Nil(err)
+	assert.Equal(3, fetches)
+}
+
+func TestConfigCache_Entries(t *testing.T) {
+	assert := assert.New(t)
+	cache := NewConfigCache(time.Hour)
+
+	for _, target := range []string{"a", "b"} {
+		_, err := cache.Get(context.Background(), target, func(context.Context) (*ConfigResponse, error) {
+			return &ConfigResponse{DeviceUUID: "awair-element_" + target}, nil
+		})
+		assert.Nil(err)
+	}
+	cache.Invalidate("b")
+
+	entries := cache.Entries()
+	assert.Equal(1, len(entries))
+	assert.Equal("awair-element_a", entries["a"].DeviceUUID)
+}
+
+func TestConfigCache_EvictsExpiredEntries(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1000, 0)
+	cache := NewConfigCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	fetch := func(context.Context) (*ConfigResponse, error) {
+		return &ConfigResponse{}, nil
+	}
+
+	_, err := cache.Get(context.Background(), "a", fetch)
+	assert.Nil(err)
+	_, err = cache.GetWithTTL(context.Background(), "b", time.Hour, fetch)
+	assert.Nil(err)
+	now = now.Add(2 * time.Minute)
+
+	// Expired entries are dropped as others are cached, even if nothing asks
+	// for them again.
+	_, err = cache.Get(context.Background(), "c", fetch)
+	assert.Nil(err)
+	cache.mu.Lock()
+	assert.Equal(2, len(cache.entries))
+	assert.NotContains(cache.entries, "a")
+	cache.mu.Unlock()
+
+	now = now.Add(2 * time.Minute)
+	entries := cache.Entries()
+	assert.Equal(1, len(entries))
+	assert.Contains(entries, "b")
+}
@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	heat_index = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "heat_index"),
+		"Heat index, how hot the air feels given its humidity, per the US National Weather Service (ºC)",
+		nil,
+		nil,
+	)
+
+	humidex = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "humidex"),
+		"Humidex, how hot the air feels given its dew point, per Environment Canada (unitless, comparable to ºC)",
+		nil,
+		nil,
+	)
+
+	apparent_temp = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "apparent_temperature"),
+		"Apparent temperature in still air out of the sun, per the Australian Bureau of Meteorology (ºC)",
+		nil,
+		nil,
+	)
+
+	vapor_pressure_deficit = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "vapor_pressure_deficit"),
+		"Vapor pressure deficit, how much more moisture the air could hold (kPa)",
+		nil,
+		nil,
+	)
+)
+
+// derivedSensors are the comfort indices computed from the readings when
+// derived metrics are enabled. Each is only exported when the readings it's
+// computed from were reported.
+var derivedSensors = []sensor{
+	{"heat_index", heat_index, func(v *AwairValues) *float64 {
+		return derive2(v.Temp, v.Humidity, HeatIndex)
+	}},
+	{"humidex", humidex, func(v *AwairValues) *float64 {
+		if v.DewPoint != nil {
+			return derive2(v.Temp, v.DewPoint, Humidex)
+		}
+		// Older firmware doesn't report the dew point.
+		if v.Temp == nil || v.Humidity == nil || *v.Humidity <= 0 {
+			return nil
+		}
+		dp := DewPoint(*v.Temp, *v.Humidity)
+		return derive2(v.Temp, &dp, Humidex)
+	}},
+	{"apparent_temp", apparent_temp, func(v *AwairValues) *float64 {
+		return derive2(v.Temp, v.Humidity, ApparentTemperature)
+	}},
+	{"vapor_pressure_deficit", vapor_pressure_deficit, func(v *AwairValues) *float64 {
+		return derive2(v.Temp, v.Humidity, VaporPressureDeficit)
+	}},
+}
+
+// derive2 returns f(a, b), or nil if either reading is missing.
+func derive2(a, b *float64, f func(float64, float64) float64) *float64 {
+	if a == nil || b == nil {
+		return nil
+	}
+	v := f(*a, *b)
+	return &v
+}
+
+// HeatIndex returns the heat index for the temperature t (ºC) and relative
+// humidity rh (%), using the US National Weather Service's regression of
+// Steadman's tables: Rothfusz's equation with its adjustments, falling back to
+// the simple formula in mild conditions where the regression isn't valid.
+func HeatIndex(t, rh float64) float64 {
+	f := celsiusToFahrenheit(t)
+	hi := 0.5 * (f + 61 + (f-68)*1.2 + rh*0.094)
+	if (hi+f)/2 >= 80 {
+		hi = -42.379 + 2.04901523*f + 10.14333127*rh -
+			0.22475541*f*rh - 0.00683783*f*f - 0.05481717*rh*rh +
+			0.00122874*f*f*rh + 0.00085282*f*rh*rh - 0.00000199*f*f*rh*rh
+		switch {
+		case rh < 13 && f >= 80 && f <= 112:
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(f-95))/17)
+		case rh > 85 && f >= 80 && f <= 87:
+			hi += (rh - 85) / 10 * (87 - f) / 5
+		}
+	}
+	return fahrenheitToCelsius(hi)
+}
+
+// Humidex returns Environment Canada's humidex for the temperature t and dew
+// point dp (ºC).
+func Humidex(t, dp float64) float64 {
+	// Vapour pressure (hPa) at the dew point.
+	e := 6.11 * math.Exp(5417.7530*(1/273.16-1/(273.15+dp)))
+	return t + 5.0/9.0*(e-10)
+}
+
+// ApparentTemperature returns the Australian Bureau of Meteorology's apparent
+// temperature for the temperature t (ºC) and relative humidity rh (%), without
+// wind, as indoors.
+func ApparentTemperature(t, rh float64) float64 {
+	// Water vapour pressure (hPa).
+	e := rh / 100 * 6.105 * math.Exp(17.27*t/(237.7+t))
+	return t + 0.33*e - 4
+}
+
+// VaporPressureDeficit returns the difference (kPa) between how much moisture
+// air at temperature t (ºC) could hold and how much it holds at relative
+// humidity rh (%), using Tetens' equation for the saturation vapor pressure.
+func VaporPressureDeficit(t, rh float64) float64 {
+	svp := 0.6108 * math.Exp(17.27*t/(t+237.3))
+	return svp * (1 - rh/100)
+}
+
+// DewPoint returns the dew point (ºC) of air at temperature t (ºC) and
+// relative humidity rh (%), using the Magnus formula.
+func DewPoint(t, rh float64) float64 {
+	const b, c = 17.62, 243.12
+	gamma := math.Log(rh/100) + b*t/(c+t)
+	return c * gamma / (b - gamma)
+}
+
+func fahrenheitToCelsius(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
@@ -0,0 +1,158 @@
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func TestHeatIndex(t *testing.T) {
+	// From the US National Weather Service's heat index chart, in ºF.
+	cases := []struct {
+		temp, rh, want float64
+	}{
+		{80, 40, 80},
+		{86, 90, 105},
+		{90, 70, 106},
+		{96, 65, 121},
+		{104, 40, 119},
+		// Mild enough for the simple formula.
+		{70, 50, 69},
+	}
+	for _, cse := range cases {
+		t.Run(fmt.Sprintf("%vF_%v%%", cse.temp, cse.rh), func(t *testing.T) {
+			got := celsiusToFahrenheit(HeatIndex(fahrenheitToCelsius(cse.temp), cse.rh))
+			assert.InDelta(t, cse.want, got, 1)
+		})
+	}
+}
+
+func TestHumidex(t *testing.T) {
+	// Worked examples of Environment Canada's humidex.
+	cases := []struct {
+		temp, dewPoint, want float64
+	}{
+		{30, 15, 34},
+		{30, 25, 42},
+	}
+	for _, cse := range cases {
+		t.Run(fmt.Sprintf("%vC_%vC", cse.temp, cse.dewPoint), func(t *testing.T) {
+			assert.InDelta(t, cse.want, Humidex(cse.temp, cse.dewPoint), 0.5)
+		})
+	}
+}
+
+func TestApparentTemperature(t *testing.T) {
+	// From the Australian Bureau of Meteorology's formula, without wind.
+	cases := []struct {
+		temp, rh, want float64
+	}{
+		{25, 50, 26.2},
+		{30, 70, 35.8},
+		{20, 0, 16},
+	}
+	for _, cse := range cases {
+		t.Run(fmt.Sprintf("%vC_%v%%", cse.temp, cse.rh), func(t *testing.T) {
+			assert.InDelta(t, cse.want, ApparentTemperature(cse.temp, cse.rh), 0.1)
+		})
+	}
+}
+
+func TestVaporPressureDeficit(t *testing.T) {
+	// Saturation vapor pressures from the FAO-56 tables, in kPa.
+	cases := []struct {
+		temp, rh, want float64
+	}{
+		{20, 60, 0.936},
+		{25, 50, 1.584},
+		{30, 80, 0.849},
+		{25, 100, 0},
+	}
+	for _, cse := range cases {
+		t.Run(fmt.Sprintf("%vC_%v%%", cse.temp, cse.rh), func(t *testing.T) {
+			assert.InDelta(t, cse.want, VaporPressureDeficit(cse.temp, cse.rh), 0.005)
+		})
+	}
+}
+
+func TestDewPoint(t *testing.T) {
+	cases := []struct {
+		temp, rh, want float64
+	}{
+		{25, 60, 16.7},
+		{20, 40, 6.0},
+		{30, 100, 30},
+	}
+	for _, cse := range cases {
+		t.Run(fmt.Sprintf("%vC_%v%%", cse.temp, cse.rh), func(t *testing.T) {
+			assert.InDelta(t, cse.want, DewPoint(cse.temp, cse.rh), 0.1)
+		})
+	}
+}
+
+func TestCollect_DerivedMetrics(t *testing.T) {
+	values := `{"temp": 30, "humid": 70, "dew_point": 24}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			fmt.Fprint(w, `{"device_uuid": "awair-element_1"}`)
+		case "/air-data/latest":
+			fmt.Fprint(w, values)
+		}
+	}))
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+	derived := []string{"awair_heat_index", "awair_humidex", "awair_apparent_temperature", "awair_vapor_pressure_deficit"}
+
+	// Off by default.
+	got := gatherCollector(t, newAwairExporter(hostname))
+	for _, name := range derived {
+		assert.NotContains(t, got, name)
+	}
+
+	cases := []struct {
+		units UnitSystem
+		want  map[string]float64
+	}{
+		{UnitsMetric, map[string]float64{
+			"awair_heat_index":             HeatIndex(30, 70),
+			"awair_humidex":                Humidex(30, 24),
+			"awair_apparent_temperature":   ApparentTemperature(30, 70),
+			"awair_vapor_pressure_deficit": VaporPressureDeficit(30, 70),
+		}},
+		{UnitsImperial, map[string]float64{
+			"awair_heat_index_fahrenheit":           celsiusToFahrenheit(HeatIndex(30, 70)),
+			"awair_humidex":                         Humidex(30, 24),
+			"awair_apparent_temperature_fahrenheit": celsiusToFahrenheit(ApparentTemperature(30, 70)),
+			"awair_vapor_pressure_deficit":          VaporPressureDeficit(30, 70),
+		}},
+	}
+	for _, cse := range cases {
+		t.Run(string(cse.units), func(t *testing.T) {
+			got := gatherCollector(t, newAwairExporter(hostname, WithDerivedMetrics(true), WithUnitSystem(cse.units)))
+			for name, want := range cse.want {
+				require.Contains(t, got, name)
+				assert.InDelta(t, want, got[name].GetMetric()[0].GetGauge().GetValue(), 1e-9, name)
+			}
+		})
+	}
+
+	// Without the humidity, only the humidex can be computed.
+	values = `{"temp": 30, "dew_point": 24}`
+	got = gatherCollector(t, newAwairExporter(hostname, WithDerivedMetrics(true)))
+	assert.Contains(t, got, "awair_humidex")
+	for _, name := range []string{"awair_heat_index", "awair_apparent_temperature", "awair_vapor_pressure_deficit"} {
+		assert.NotContains(t, got, name)
+	}
+
+	// Without the dew point, it's computed from the humidity.
+	values = `{"temp": 30, "humid": 70}`
+	got = gatherCollector(t, newAwairExporter(hostname, WithDerivedMetrics(true)))
+	require.Contains(t, got, "awair_humidex")
+	assert.InDelta(t, Humidex(30, DewPoint(30, 70)), got["awair_humidex"].GetMetric()[0].GetGauge().GetValue(), 1e-9)
+}
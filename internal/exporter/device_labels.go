@@ -0,0 +1,137 @@
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Labels attached to every metric of a device by WithDeviceLabels and
+// WithDisplayName.
+const (
+	DeviceUUIDLabel  = "device_uuid"
+	DisplayNameLabel = "display_name"
+)
+
+// info_by_device is awair_device_info for exporters attaching device_uuid to
+// every metric, which supplies its device_uuid label.
+var info_by_device = prometheus.NewDesc(
+	prometheus.BuildFQName("awair", "", "device_info"),
+	"Info about the awair device",
+	[]string{
+		"firmware_version",
+		"model",
+		"timezone",
+		"voc_feature_set",
+	},
+	nil,
+)
+
+// DeviceRegistry remembers which device was last scraped at each host, so the
+// device's identity is known even when a scrape fails to fetch its config.
+type DeviceRegistry interface {
+	// Observe records that the device with config was scraped at host.
+	Observe(host string, config *ConfigResponse)
+	// UUIDOf returns the device_uuid of the device last scraped at host.
+	UUIDOf(host string) (string, bool)
+}
+
+// WithDeviceLabels attaches the device's device_uuid as a label to every
+// metric, so its series keep their identity when its address changes. When
+// the config can't be fetched, the device_uuid comes from the device registry.
+func WithDeviceLabels(enabled bool) Option {
+	return func(e *AwairExporter) {
+		e.deviceLabels = enabled
+	}
+}
+
+// WithDisplayName attaches name as the display_name label to every metric.
+func WithDisplayName(name string) Option {
+	return func(e *AwairExporter) {
+		e.displayName = name
+	}
+}
+
+// WithDeviceRegistry records every device scraped in registry.
+func WithDeviceRegistry(registry DeviceRegistry) Option {
+	return func(e *AwairExporter) {
+		e.registry = registry
+	}
+}
+
+// labelsDevice reports whether the exporter attaches labels to every metric.
+// Their values aren't known before a scrape, so such an exporter is an
+// unchecked collector.
+func (e *AwairExporter) labelsDevice() bool {
+	return e.deviceLabels || e.displayName != ""
+}
+
+// deviceUUID returns the device_uuid to attach to every metric of the device
+// with config, which is nil if it couldn't be fetched.
+func (e *AwairExporter) deviceUUID(config *ConfigResponse) (string, bool) {
+	if !e.deviceLabels {
+		return "", false
+	}
+	if config != nil && config.DeviceUUID != "" {
+		return config.DeviceUUID, true
+	}
+	if e.registry != nil {
+		return e.registry.UUIDOf(e.hostname)
+	}
+	return "", false
+}
+
+// deviceLabelValues returns the labels to attach to every metric of the
+// device with config.
+func (e *AwairExporter) deviceLabelValues(config *ConfigResponse) prometheus.Labels {
+	labels := prometheus.Labels{}
+	if uuid, ok := e.deviceUUID(config); ok {
+		labels[DeviceUUIDLabel] = uuid
+	}
+	if e.displayName != "" {
+		labels[DisplayNameLabel] = e.displayName
+	}
+	return labels
+}
+
+// collectDevice emits the metrics collect emits, with the device labels of the
+// device with config attached.
+func (e *AwairExporter) collectDevice(ch chan<- prometheus.Metric, config *ConfigResponse, collect func(ch chan<- prometheus.Metric)) {
+	labels := e.deviceLabelValues(config)
+	if len(labels) == 0 {
+		collect(ch)
+		return
+	}
+	var r capturingRegisterer
+	prometheus.WrapRegistererWith(labels, &r).MustRegister(collectorFunc(collect))
+	r.collector.Collect(ch)
+}
+
+// collectorFunc adapts a function emitting metrics to an unchecked
+// prometheus.Collector.
+type collectorFunc func(ch chan<- prometheus.Metric)
+
+func (f collectorFunc) Describe(chan<- *prometheus.Desc) {}
+
+func (f collectorFunc) Collect(ch chan<- prometheus.Metric) {
+	f(ch)
+}
+
+// capturingRegisterer keeps the collector registered with it, which lets
+// prometheus.WrapRegistererWith attach labels to a collector's metrics.
+type capturingRegisterer struct {
+	collector prometheus.Collector
+}
+
+func (r *capturingRegisterer) Register(c prometheus.Collector) error {
+	r.collector = c
+	return nil
+}
+
+func (r *capturingRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		r.collector = c
+	}
+}
+
+func (r *capturingRegisterer) Unregister(prometheus.Collector) bool {
+	return false
+}
@@ -0,0 +1,140 @@
+package exporter
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+// fakeRegistry is a DeviceRegistry remembering the device_uuid of each host.
+type fakeRegistry struct {
+	mu    sync.Mutex
+	uuids map[string]string
+}
+
+func (r *fakeRegistry) Observe(host string, config *ConfigResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uuids[host] = config.DeviceUUID
+}
+
+func (r *fakeRegistry) UUIDOf(host string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	uuid, ok := r.uuids[host]
+	return uuid, ok
+}
+
+// labelValues returns the values of the label called name on every metric of
+// every family, and how often the label appears on a single metric at most.
+func labelValues(families map[string]*dto.MetricFamily, name string) (map[string]bool, int) {
+	values := map[string]bool{}
+	most := 0
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			n := 0
+			for _, l := range m.GetLabel() {
+				if l.GetName() == name {
+					values[l.GetValue()] = true
+					n++
+				}
+			}
+			if n == 0 {
+				values[""] = true
+			}
+			most = max(most, n)
+		}
+	}
+	return values, most
+}
+
+func TestCollect_DeviceLabels(t *testing.T) {
+	srv := getTestServer()
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	cases := []struct {
+		name        string
+		opts        []Option
+		uuid        string
+		displayName string
+	}{
+		{"none", nil, "", ""},
+		{"device_uuid", []Option{WithDeviceLabels(true)}, "awair-element_1", ""},
+		{"display_name", []Option{WithDisplayName("Office")}, "", "Office"},
+		{"both", []Option{WithDeviceLabels(true), WithDisplayName("Office")}, "awair-element_1", "Office"},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			assert := assert.New(t)
+			got := gatherCollector(t, newAwairExporter(hostname, cse.opts...))
+			assert.Contains(got, "awair_score")
+
+			if cse.uuid != "" {
+				uuids, most := labelValues(got, DeviceUUIDLabel)
+				assert.Equal(map[string]bool{cse.uuid: true}, uuids)
+				assert.Equal(1, most)
+			} else {
+				// Only awair_device_info has it.
+				uuids, _ := labelValues(got, DeviceUUIDLabel)
+				assert.Equal(map[string]bool{"": true, "awair-element_1": true}, uuids)
+			}
+			names, _ := labelValues(got, DisplayNameLabel)
+			assert.Equal(map[string]bool{cse.displayName: true}, names)
+		})
+	}
+}
+
+func TestCollect_DeviceLabelsFromRegistry(t *testing.T) {
+	assert := assert.New(t)
+	srv := getFailingTestServer("/settings/config/data")
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	// The config can't be fetched, and the host is unknown.
+	registry := &fakeRegistry{uuids: map[string]string{}}
+	e := newAwairExporter(hostname, WithDeviceLabels(true), WithDeviceRegistry(registry))
+	uuids, _ := labelValues(gatherCollector(t, e), DeviceUUIDLabel)
+	assert.Equal(map[string]bool{"": true}, uuids)
+
+	// A previous scrape of the host fetched its config.
+	registry.uuids[hostname] = "awair-element_1"
+	uuids, _ = labelValues(gatherCollector(t, e), DeviceUUIDLabel)
+	assert.Equal(map[string]bool{"awair-element_1": true}, uuids)
+}
+
+func TestScrape_ObservesDevice(t *testing.T) {
+	srv := getTestServer()
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	registry := &fakeRegistry{uuids: map[string]string{}}
+	newAwairExporter(hostname, WithDeviceRegistry(registry)).Scrape(context.Background())
+	uuid, ok := registry.UUIDOf(hostname)
+	assert.True(t, ok)
+	assert.Equal(t, "awair-element_1", uuid)
+}
+
+func TestPoller_DeviceLabels(t *testing.T) {
+	srv := getTestServer()
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	p := NewPoller()
+	defer p.Stop()
+	p.Add(context.Background(), hostname, time.Hour)
+	c, ok := p.Collector(hostname, WithDeviceLabels(true))
+	require.True(t, ok)
+	require.Eventually(t, func() bool {
+		return len(gatherCollector(t, c)) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	uuids, _ := labelValues(gatherCollector(t, c), DeviceUUIDLabel)
+	assert.Equal(t, map[string]bool{"awair-element_1": true}, uuids)
+}
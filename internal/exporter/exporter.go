@@ -1,12 +1,17 @@
 package exporter
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
@@ -111,33 +116,243 @@ var (
 		nil,
 		nil,
 	)
+	lux = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "lux"),
+		"Illuminance (lux - Omni and Mint only)",
+		nil,
+		nil,
+	)
+
+	spl_a = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "spl_a"),
+		"A-weighted sound pressure level (dBA - Omni only)",
+		nil,
+		nil,
+	)
+
+	dust = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "dust"),
+		"Dust, including particulate matter up to 10 microns in diameter (µg/m³ - 2nd Edition only)",
+		nil,
+		nil,
+	)
+
 	info = prometheus.NewDesc(
 		prometheus.BuildFQName("awair", "", "device_info"),
 		"Info about the awair device",
 		[]string{
 			"device_uuid",
 			"firmware_version",
+			"model",
+			"timezone",
 			"voc_feature_set",
 		},
 		nil,
 	)
+
+	network_info = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "network_info"),
+		"Network configuration of the awair device",
+		[]string{
+			"wifi_mac",
+			"ssid",
+			"ip",
+			"netmask",
+			"gateway",
+		},
+		nil,
+	)
+
+	led_brightness = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "led_brightness"),
+		"Brightness of the awair device's LEDs (0-255)",
+		nil,
+		nil,
+	)
+
+	led_mode = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "led_mode"),
+		"Mode of the awair device's LEDs (1 for the current mode)",
+		[]string{"mode"},
+		nil,
+	)
+
+	display_mode = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "display_mode"),
+		"Reading shown on the awair device's display (1 for the current mode)",
+		[]string{"mode"},
+		nil,
+	)
+
+	up = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "up"),
+		"Whether every endpoint of the Awair device was fetched successfully (1 = up, 0 = down)",
+		nil,
+		nil,
+	)
+
+	scrape_success = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "scrape_success"),
+		"Whether the last fetch of the given Awair device endpoint succeeded",
+		[]string{"endpoint"},
+		nil,
+	)
+
+	reading_timestamp = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "reading_timestamp_seconds"),
+		"Unix timestamp at which the Awair device took the latest readings, according to its own clock",
+		nil,
+		nil,
+	)
+
+	reading_timestamp_valid = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "reading_timestamp_valid"),
+		"Whether the Awair device's reading timestamp is within five minutes of the exporter's clock (0 = the device clock is wrong)",
+		nil,
+		nil,
+	)
+
+	sensor_present = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "sensor_present"),
+		"Whether the Awair device reported a reading for the given sensor",
+		[]string{"sensor"},
+		nil,
+	)
+
+	scrape_timeout = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "scrape_timeout"),
+		"Whether the last scrape of the Awair device hit its deadline (1 = timed out)",
+		nil,
+		nil,
+	)
 )
 
+// maxClockSkew is how far a device's reading timestamp may be from the time the
+// readings were fetched before the device clock is considered wrong.
+const maxClockSkew = 5 * time.Minute
+
+// ErrClockSkew is returned when a device reports readings from a time which
+// can't be right, usually because its clock never synced.
+var ErrClockSkew = errors.New("device clock is out of sync")
+
+// skewedClocks holds the targets whose reading timestamp was last found
+// unusable, so it's logged when that changes rather than on every scrape.
+var skewedClocks = struct {
+	sync.Mutex
+	targets map[string]bool
+}{targets: map[string]bool{}}
+
+// logReadingTimeChange logs when target's reading timestamp, checked with err,
+// becomes unusable or usable again.
+func logReadingTimeChange(target string, err error) {
+	skewedClocks.Lock()
+	skewed := skewedClocks.targets[target]
+	if err != nil {
+		skewedClocks.targets[target] = true
+	} else {
+		delete(skewedClocks.targets, target)
+	}
+	skewedClocks.Unlock()
+
+	switch {
+	case err != nil && !skewed:
+		log.Warn().Err(err).
+			Str("hostname", target).
+			Msg("Not using the device's reading timestamp")
+	case err == nil && skewed:
+		log.Info().
+			Str("hostname", target).
+			Msg("Using the device's reading timestamp again")
+	}
+}
+
+// DefaultTimeout bounds every request to a device when no other timeout is configured.
+const DefaultTimeout = 10 * time.Second
+
+// ledModes and displayModes are the modes reported as 0 in the awair_led_mode
+// and awair_display_mode state sets when the device isn't using them.
+var (
+	ledModes     = []string{"auto", "manual", "sleep"}
+	displayModes = []string{"score", "temp", "humid", "co2", "voc", "pm25", "clock"}
+)
+
+const (
+	endpointAirData = "air-data"
+	endpointConfig  = "config"
+)
+
+// AwairValues holds the readings from /air-data/latest. Which sensors are
+// present depends on the model, so every reading is nil when the device
+// doesn't report it, distinguishing a missing sensor from a reading of 0.
 type AwairValues struct {
-	Score          float64 `json:"score"`
-	DewPoint       float64 `json:"dew_point"`
-	Temp           float64 `json:"temp"`
-	Humidity       float64 `json:"humid"`
-	AbsHumidity    float64 `json:"abs_humid"`
-	CO2            float64 `json:"co2"`
-	CO2Est         float64 `json:"co2_est"`
-	CO2EstBaseline float64 `json:"co2_est_baseline"`
-	Voc            float64 `json:"voc"`
-	VocBaseline    float64 `json:"voc_baseline"`
-	VocH2Raw       float64 `json:"voc_h2_raw"`
-	VocEthanolRaw  float64 `json:"voc_ethanol_raw"`
-	PM25           float64 `json:"pm25"`
-	PM10Est        float64 `json:"pm10_est"`
+	Timestamp      string   `json:"timestamp"`
+	Score          *float64 `json:"score,omitempty"`
+	DewPoint       *float64 `json:"dew_point,omitempty"`
+	Temp           *float64 `json:"temp,omitempty"`
+	Humidity       *float64 `json:"humid,omitempty"`
+	AbsHumidity    *float64 `json:"abs_humid,omitempty"`
+	CO2            *float64 `json:"co2,omitempty"`
+	CO2Est         *float64 `json:"co2_est,omitempty"`
+	CO2EstBaseline *float64 `json:"co2_est_baseline,omitempty"`
+	Voc            *float64 `json:"voc,omitempty"`
+	VocBaseline    *float64 `json:"voc_baseline,omitempty"`
+	VocH2Raw       *float64 `json:"voc_h2_raw,omitempty"`
+	VocEthanolRaw  *float64 `json:"voc_ethanol_raw,omitempty"`
+	PM25           *float64 `json:"pm25,omitempty"`
+	PM10Est        *float64 `json:"pm10_est,omitempty"`
+	Lux            *float64 `json:"lux,omitempty"`
+	SPLA           *float64 `json:"spl_a,omitempty"`
+	Dust           *float64 `json:"dust,omitempty"`
+
+	// Unknown holds the numeric fields which don't map to a known sensor.
+	Unknown map[string]float64 `json:"-"`
+}
+
+// sensor maps a reading in AwairValues to the metric it's exported as.
+type sensor struct {
+	// name is the key of the reading in /air-data/latest.
+	name  string
+	desc  *prometheus.Desc
+	value func(*AwairValues) *float64
+}
+
+var sensors = []sensor{
+	{"score", score, func(v *AwairValues) *float64 { return v.Score }},
+	{"dew_point", dew_point, func(v *AwairValues) *float64 { return v.DewPoint }},
+	{"temp", temp, func(v *AwairValues) *float64 { return v.Temp }},
+	{"humid", humidity, func(v *AwairValues) *float64 { return v.Humidity }},
+	{"abs_humid", abs_humidity, func(v *AwairValues) *float64 { return v.AbsHumidity }},
+	{"co2", co2, func(v *AwairValues) *float64 { return v.CO2 }},
+	{"co2_est", co2_estimated, func(v *AwairValues) *float64 { return v.CO2Est }},
+	{"co2_est_baseline", co2_estimate_baseline, func(v *AwairValues) *float64 { return v.CO2EstBaseline }},
+	{"voc", voc, func(v *AwairValues) *float64 { return v.Voc }},
+	{"voc_baseline", voc_baseline, func(v *AwairValues) *float64 { return v.VocBaseline }},
+	{"voc_h2_raw", voc_h2_raw, func(v *AwairValues) *float64 { return v.VocH2Raw }},
+	{"voc_ethanol_raw", voc_ethanol_raw, func(v *AwairValues) *float64 { return v.VocEthanolRaw }},
+	{"pm25", pm25, func(v *AwairValues) *float64 { return v.PM25 }},
+	{"pm10_est", pm10, func(v *AwairValues) *float64 { return v.PM10Est }},
+	{"lux", lux, func(v *AwairValues) *float64 { return v.Lux }},
+	{"spl_a", spl_a, func(v *AwairValues) *float64 { return v.SPLA }},
+	{"dust", dust, func(v *AwairValues) *float64 { return v.Dust }},
+}
+
+// ReadingTime returns the time at which the device took the readings.
+func (v *AwairValues) ReadingTime() (time.Time, error) {
+	if v.Timestamp == "" {
+		return time.Time{}, errors.New("device did not report a reading timestamp")
+	}
+	return time.Parse(time.RFC3339Nano, v.Timestamp)
+}
+
+// checkReadingTime returns an error wrapping ErrClockSkew if readingTime is
+// too far from fetched, the time the readings were retrieved from the device.
+func checkReadingTime(readingTime, fetched time.Time) error {
+	skew := readingTime.Sub(fetched)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("%w: reading timestamp %s is %s away from %s",
+			ErrClockSkew, readingTime.Format(time.RFC3339), skew.Round(time.Second), fetched.Format(time.RFC3339))
+	}
+	return nil
 }
 
 type LEDSettings struct {
@@ -160,55 +375,262 @@ type ConfigResponse struct {
 }
 
 type AwairExporter struct {
-	hostname string
+	hostname          string
+	timeout           time.Duration
+	ctx               context.Context
+	client            *http.Client
+	cache             *ConfigCache
+	readingTimestamps bool
+	rawFields         *RawFields
+	cacheTTL          *time.Duration
+	groups            map[MetricGroup]bool
+	units             UnitSystem
+	derived           bool
+	aqiStandards      []AQIStandard
+	basicAuth         *basicAuth
+	bearerToken       string
+	deviceLabels      bool
+	displayName       string
+	registry          DeviceRegistry
 }
 
-func NewAwairExporter(hostname string) (*AwairExporter, error) {
-	ex := &AwairExporter{
-		hostname: hostname,
+type basicAuth struct {
+	username, password string
+}
+
+// Option configures optional behaviour of an AwairExporter.
+type Option func(*AwairExporter)
+
+// WithTimeout bounds each scrape of the device, including every request it makes.
+func WithTimeout(timeout time.Duration) Option {
+	return func(e *AwairExporter) {
+		e.timeout = timeout
+	}
+}
+
+// WithHTTPClient sets the client used to talk to the device. Share one client
+// between exporters so connections to each device are reused.
+func WithHTTPClient(client *http.Client) Option {
+	return func(e *AwairExporter) {
+		e.client = client
+	}
+}
+
+// WithConfigCache serves the device config from cache rather than fetching
+// it on every scrape.
+func WithConfigCache(cache *ConfigCache) Option {
+	return func(e *AwairExporter) {
+		e.cache = cache
+	}
+}
+
+// WithReadingTimestamps attaches the device's own reading timestamp to the
+// sensor metrics, rather than letting Prometheus use the scrape time. The
+// timestamp is ignored if the device clock is clearly wrong.
+func WithReadingTimestamps(enabled bool) Option {
+	return func(e *AwairExporter) {
+		e.readingTimestamps = enabled
+	}
+}
+
+// WithRawFields exports fields of /air-data/latest unknown to the exporter
+// as awair_raw.
+func WithRawFields(rawFields *RawFields) Option {
+	return func(e *AwairExporter) {
+		e.rawFields = rawFields
+	}
+}
+
+// WithConfigCacheTTL overrides how long the config cache's entries are fresh
+// for this exporter. A TTL of 0 always fetches the config, but still refreshes
+// the cache for other exporters.
+func WithConfigCacheTTL(ttl time.Duration) Option {
+	return func(e *AwairExporter) {
+		e.cacheTTL = &ttl
+	}
+}
+
+// WithMetricGroups limits the exported metrics to those in groups. Every group
+// is exported if groups is empty.
+func WithMetricGroups(groups ...MetricGroup) Option {
+	return func(e *AwairExporter) {
+		e.groups = nil
+		if len(groups) == 0 {
+			return
+		}
+		e.groups = map[MetricGroup]bool{}
+		for _, g := range groups {
+			e.groups[g] = true
+		}
+	}
+}
+
+// WithUnitSystem exports readings in the given units rather than metric.
+func WithUnitSystem(units UnitSystem) Option {
+	return func(e *AwairExporter) {
+		e.units = units
+	}
+}
+
+// WithDerivedMetrics exports metrics the exporter computes from the readings,
+// on top of those reported by the device.
+func WithDerivedMetrics(enabled bool) Option {
+	return func(e *AwairExporter) {
+		e.derived = enabled
+	}
+}
+
+// WithBasicAuth authenticates requests to the device, or a proxy in front of
+// it, with HTTP basic auth.
+func WithBasicAuth(username, password string) Option {
+	return func(e *AwairExporter) {
+		e.basicAuth = &basicAuth{username: username, password: password}
+	}
+}
+
+// WithBearerToken authenticates requests to the device, or a proxy in front of
+// it, with a bearer token.
+func WithBearerToken(token string) Option {
+	return func(e *AwairExporter) {
+		e.bearerToken = token
+	}
+}
+
+// WithContext ties device requests to ctx, e.g. the incoming probe request, so
+// they are abandoned once the caller goes away.
+func WithContext(ctx context.Context) Option {
+	return func(e *AwairExporter) {
+		e.ctx = ctx
 	}
-	config, err := ex.GetConfig()
+}
+
+func NewAwairExporter(hostname string, opts ...Option) (*AwairExporter, error) {
+	ex := newAwairExporter(hostname, opts...)
+	ctx, cancel := context.WithTimeout(ex.context(), ex.timeoutOrDefault())
+	defer cancel()
+	config, err := ex.config(ctx)
 	if err != nil {
 		return nil, err
 	}
 	log.Info().
+		Str("model", string(config.Model())).
 		Interface("config", config).
 		Msg("Successfully connected to Awair device.")
 
 	return ex, nil
 }
 
+// NewLazyAwairExporter returns an exporter for the device at hostname without
+// connecting to it first, so a device which can't be reached is reported by
+// awair_up 0 when it's scraped, rather than by an error.
+func NewLazyAwairExporter(hostname string, opts ...Option) *AwairExporter {
+	return newAwairExporter(hostname, opts...)
+}
+
+// FetchConfig fetches the /settings/config/data response of the device at
+// hostname, e.g. to check that a host is an Awair device.
+func FetchConfig(ctx context.Context, hostname string, opts ...Option) (*ConfigResponse, error) {
+	ex := newAwairExporter(hostname, opts...)
+	ctx, cancel := context.WithTimeout(ctx, ex.timeoutOrDefault())
+	defer cancel()
+	return ex.GetConfig(ctx)
+}
+
+// newAwairExporter builds an exporter without checking the device is reachable.
+func newAwairExporter(hostname string, opts ...Option) *AwairExporter {
+	ex := &AwairExporter{
+		hostname: hostname,
+	}
+	for _, opt := range opts {
+		opt(ex)
+	}
+	return ex
+}
+
 func (e *AwairExporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- score
-	ch <- dew_point
-	ch <- temp
-	ch <- humidity
-	ch <- abs_humidity
-	ch <- co2
-	ch <- co2_estimated
-	ch <- co2_estimate_baseline
-	ch <- voc
-	ch <- voc_baseline
-	ch <- voc_h2_raw
-	ch <- voc_ethanol_raw
-	ch <- pm25
-	ch <- pm10
+	if e.labelsDevice() {
+		return
+	}
+	for _, sensor := range sensors {
+		desc, _ := e.sensorDesc(sensor)
+		ch <- desc
+	}
+	if e.derived {
+		for _, sensor := range derivedSensors {
+			desc, _ := e.sensorDesc(sensor)
+			ch <- desc
+		}
+	}
+	if len(e.aqiStandards) > 0 {
+		ch <- aqi
+		ch <- aqi_category
+	}
+	ch <- sensor_present
+	ch <- raw
 	ch <- info
+	ch <- network_info
+	ch <- led_brightness
+	ch <- led_mode
+	ch <- display_mode
+	ch <- up
+	ch <- scrape_success
+	ch <- scrape_timeout
+	ch <- reading_timestamp
+	ch <- reading_timestamp_valid
 }
 
-func (e *AwairExporter) GetMetrics() (*AwairValues, error) {
-	uri := fmt.Sprintf("http://%s/air-data/latest", e.hostname)
-	log.Debug().
-		Str("uri", uri).
-		Msg("Attempting to retrieve metrics from Awair device.")
+// IsReservedLabel reports whether name is the name of a label of any of the
+// exporter's metrics, so can't be attached to them as a target label.
+func IsReservedLabel(name string) bool {
+	// Describe every metric, and see whether registering them with the label
+	// added conflicts.
+	e := newAwairExporter("", WithDerivedMetrics(true), WithAQIStandards(AQIStandards...))
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{name: "reserved"}, prometheus.NewRegistry())
+	return reg.Register(e) != nil
+}
 
-	resp, err := http.Get(uri)
+// url returns the URL of path on the device. hostname is either a host,
+// optionally with a port, or the URL of a proxy in front of the device, such
+// as https://proxy.example.com/awair/office.
+func (e *AwairExporter) url(path string) string {
+	if strings.Contains(e.hostname, "://") {
+		return strings.TrimSuffix(e.hostname, "/") + path
+	}
+	return "http://" + e.hostname + path
+}
+
+// get returns the body of path on the device.
+func (e *AwairExporter) get(ctx context.Context, path string) ([]byte, error) {
+	uri := e.url(path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if e.basicAuth != nil {
+		req.SetBasicAuth(e.basicAuth.username, e.basicAuth.password)
+	}
+	if e.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+e.bearerToken)
+	}
+	resp, err := e.httpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Drain the body so the connection can be reused.
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("unexpected status from %s: %s", uri, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+func (e *AwairExporter) GetMetrics(ctx context.Context) (*AwairValues, error) {
+	log.Debug().
+		Str("uri", e.url("/air-data/latest")).
+		Msg("Attempting to retrieve metrics from Awair device.")
+
+	body, err := e.get(ctx, "/air-data/latest")
 	if err != nil {
 		return nil, err
 	}
@@ -217,22 +639,19 @@ func (e *AwairExporter) GetMetrics() (*AwairValues, error) {
 	if err != nil {
 		return nil, err
 	}
+	values.Unknown, err = unknownFields(body)
+	if err != nil {
+		return nil, err
+	}
 	return &values, nil
 }
 
-func (e *AwairExporter) GetConfig() (*ConfigResponse, error) {
-	uri := fmt.Sprintf("http://%s/settings/config/data", e.hostname)
+func (e *AwairExporter) GetConfig(ctx context.Context) (*ConfigResponse, error) {
 	log.Debug().
-		Str("uri", uri).
+		Str("uri", e.url("/settings/config/data")).
 		Msg("Attempting to retrieve config from Awair device.")
 
-	resp, err := http.Get(uri)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := e.get(ctx, "/settings/config/data")
 	if err != nil {
 		return nil, err
 	}
@@ -244,84 +663,249 @@ func (e *AwairExporter) GetConfig() (*ConfigResponse, error) {
 	return &config, nil
 }
 
-func (e *AwairExporter) Collect(ch chan<- prometheus.Metric) {
-	values := &AwairValues{}
-	config := &ConfigResponse{}
+// Sample is the outcome of fetching every endpoint of a device once.
+type Sample struct {
+	Values    *AwairValues
+	Config    *ConfigResponse
+	ValuesErr error
+	ConfigErr error
+	Time      time.Time
+}
+
+// Success reports whether every endpoint of the device was fetched.
+func (s *Sample) Success() bool {
+	return s.ValuesErr == nil && s.ConfigErr == nil
+}
+
+// Scrape fetches the latest readings and config from the device, within the
+// exporter's timeout or by ctx's deadline, whichever comes first.
+func (e *AwairExporter) Scrape(ctx context.Context) *Sample {
+	sample := &Sample{}
+	ctx, cancel := context.WithTimeout(ctx, e.timeoutOrDefault())
+	defer cancel()
 
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 	go func() {
-		var err error
-		values, err = e.GetMetrics()
-		if err != nil {
-			log.Error().Err(err).
+		defer wg.Done()
+		sample.Values, sample.ValuesErr = e.GetMetrics(ctx)
+		if sample.ValuesErr != nil {
+			log.Error().Err(sample.ValuesErr).
+				Str("hostname", e.hostname).
 				Msg("Error retrieving Metrics from device")
+			return
 		}
-		wg.Done()
 		log.Debug().
-			Interface("metrics", values).
+			Interface("metrics", sample.Values).
 			Msg("Metrics successfully retrieved")
 	}()
 	go func() {
-		var err error
-		config, err = e.GetConfig()
-		if err != nil {
-			log.Error().Err(err).
-				Msg("Error retrieving Metrics from device")
+		defer wg.Done()
+		sample.Config, sample.ConfigErr = e.config(ctx)
+		if sample.ConfigErr != nil {
+			log.Error().Err(sample.ConfigErr).
+				Str("hostname", e.hostname).
+				Msg("Error retrieving Config from device")
+			return
 		}
 		log.Debug().
-			Interface("config", config).
+			Interface("config", sample.Config).
 			Msg("Config successfully retrieved")
-		wg.Done()
 	}()
 	wg.Wait()
+	sample.Time = time.Now()
 
+	if e.cache != nil && !sample.Success() {
+		e.cache.Invalidate(e.hostname)
+	}
+	if e.registry != nil && sample.ConfigErr == nil {
+		e.registry.Observe(e.hostname, sample.Config)
+	}
+	return sample
+}
+
+func (e *AwairExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collectSample(ch, e.Scrape(e.context()))
+}
+
+func (e *AwairExporter) collectSample(ch chan<- prometheus.Metric, sample *Sample) {
+	e.collectDevice(ch, sample.Config, func(ch chan<- prometheus.Metric) {
+		collectStatus(ch, sample)
+		if sample.ValuesErr == nil {
+			e.collectValues(ch, sample.Values, sample.Time)
+		}
+		if sample.ConfigErr == nil {
+			e.collectConfig(ch, sample.Config)
+		}
+	})
+}
+
+// collectStatus emits the metrics describing whether the device could be scraped.
+func collectStatus(ch chan<- prometheus.Metric, sample *Sample) {
 	ch <- prometheus.MustNewConstMetric(
-		score, prometheus.GaugeValue, values.Score,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		dew_point, prometheus.GaugeValue, values.DewPoint,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		temp, prometheus.GaugeValue, values.Temp,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		humidity, prometheus.GaugeValue, values.Humidity,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		abs_humidity, prometheus.GaugeValue, values.AbsHumidity,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		co2, prometheus.GaugeValue, values.CO2,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		co2_estimated, prometheus.GaugeValue, values.CO2Est,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		co2_estimate_baseline, prometheus.GaugeValue, values.CO2EstBaseline,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		voc, prometheus.GaugeValue, values.Voc,
+		up, prometheus.GaugeValue, boolToFloat(sample.Success()),
 	)
 	ch <- prometheus.MustNewConstMetric(
-		voc_baseline, prometheus.GaugeValue, values.VocBaseline,
+		scrape_success, prometheus.GaugeValue, boolToFloat(sample.ValuesErr == nil), endpointAirData,
 	)
 	ch <- prometheus.MustNewConstMetric(
-		voc_h2_raw, prometheus.GaugeValue, values.VocH2Raw,
+		scrape_success, prometheus.GaugeValue, boolToFloat(sample.ConfigErr == nil), endpointConfig,
 	)
+	timedOut := errors.Is(sample.ValuesErr, context.DeadlineExceeded) || errors.Is(sample.ConfigErr, context.DeadlineExceeded)
 	ch <- prometheus.MustNewConstMetric(
-		voc_ethanol_raw, prometheus.GaugeValue, values.VocEthanolRaw,
+		scrape_timeout, prometheus.GaugeValue, boolToFloat(timedOut),
 	)
+}
+
+func (e *AwairExporter) config(ctx context.Context) (*ConfigResponse, error) {
+	if e.cache == nil {
+		return e.GetConfig(ctx)
+	}
+	if e.cacheTTL != nil {
+		return e.cache.GetWithTTL(ctx, e.hostname, *e.cacheTTL, e.GetConfig)
+	}
+	return e.cache.Get(ctx, e.hostname, e.GetConfig)
+}
+
+func (e *AwairExporter) context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+func (e *AwairExporter) httpClient() *http.Client {
+	if e.client == nil {
+		return defaultClient
+	}
+	return e.client
+}
+
+func (e *AwairExporter) timeoutOrDefault() time.Duration {
+	if e.timeout <= 0 {
+		return DefaultTimeout
+	}
+	return e.timeout
+}
+
+// collectValues emits the sensor readings, fetched from the device at fetched.
+func (e *AwairExporter) collectValues(ch chan<- prometheus.Metric, values *AwairValues, fetched time.Time) {
+	if e.exports(GroupSensors) {
+		e.collectSensors(ch, values, fetched)
+	}
+	if e.rawFields != nil && e.exports(GroupRaw) {
+		e.rawFields.collect(ch, e.hostname, values)
+	}
+}
+
+func (e *AwairExporter) collectSensors(ch chan<- prometheus.Metric, values *AwairValues, fetched time.Time) {
+	readingTime, err := values.ReadingTime()
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			reading_timestamp, prometheus.GaugeValue, float64(readingTime.UnixNano())/1e9,
+		)
+		err = checkReadingTime(readingTime, fetched)
+	}
 	ch <- prometheus.MustNewConstMetric(
-		pm25, prometheus.GaugeValue, values.PM25,
+		reading_timestamp_valid, prometheus.GaugeValue, boolToFloat(err == nil),
 	)
+
+	var ts time.Time
+	if e.readingTimestamps {
+		logReadingTimeChange(e.hostname, err)
+		if err == nil {
+			ts = readingTime
+		}
+	}
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) prometheus.Metric {
+		m := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+		if ts.IsZero() {
+			return m
+		}
+		return prometheus.NewMetricWithTimestamp(ts, m)
+	}
+
+	for _, sensor := range sensors {
+		value := sensor.value(values)
+		ch <- prometheus.MustNewConstMetric(
+			sensor_present, prometheus.GaugeValue, boolToFloat(value != nil), sensor.name,
+		)
+		if value != nil {
+			desc, convert := e.sensorDesc(sensor)
+			ch <- gauge(desc, convert(*value))
+		}
+	}
+	if e.derived {
+		for _, sensor := range derivedSensors {
+			if value := sensor.value(values); value != nil {
+				desc, convert := e.sensorDesc(sensor)
+				ch <- gauge(desc, convert(*value))
+			}
+		}
+	}
+	if len(e.aqiStandards) > 0 {
+		e.collectAQI(ch, values, gauge)
+	}
+}
+
+func (e *AwairExporter) collectConfig(ch chan<- prometheus.Metric, config *ConfigResponse) {
+	if !e.exports(GroupDevice) {
+		return
+	}
+	if _, ok := e.deviceUUID(config); ok {
+		// device_uuid is already attached to every metric.
+		ch <- prometheus.MustNewConstMetric(
+			info_by_device, prometheus.GaugeValue, 1,
+			config.FirmwareVersion,
+			string(config.Model()),
+			config.Timezone,
+			strconv.Itoa(config.VocFeatureSet),
+		)
+	} else {
+		ch <- prometheus.MustNewConstMetric(
+			info, prometheus.GaugeValue, 1,
+			config.DeviceUUID,
+			config.FirmwareVersion,
+			string(config.Model()),
+			config.Timezone,
+			strconv.Itoa(config.VocFeatureSet),
+		)
+	}
 	ch <- prometheus.MustNewConstMetric(
-		pm10, prometheus.GaugeValue, values.PM10Est,
+		network_info, prometheus.GaugeValue, 1,
+		config.WifiMAC,
+		config.SSID,
+		config.IP,
+		config.Netmask,
+		config.Gateway,
 	)
 	ch <- prometheus.MustNewConstMetric(
-		info, prometheus.GaugeValue, 1,
-		config.DeviceUUID,
-		config.FirmwareVersion,
-		strconv.Itoa(config.VocFeatureSet),
+		led_brightness, prometheus.GaugeValue, float64(config.LED.Brightness),
 	)
+	collectStateSet(ch, led_mode, ledModes, config.LED.Mode)
+	collectStateSet(ch, display_mode, displayModes, config.Display)
+}
+
+// collectStateSet emits a series for each of states, set to 1 for current and
+// 0 otherwise. A current state missing from states is emitted as well.
+func collectStateSet(ch chan<- prometheus.Metric, desc *prometheus.Desc, states []string, current string) {
+	known := false
+	for _, state := range states {
+		known = known || state == current
+		ch <- prometheus.MustNewConstMetric(
+			desc, prometheus.GaugeValue, boolToFloat(state == current), state,
+		)
+	}
+	if !known && current != "" {
+		ch <- prometheus.MustNewConstMetric(
+			desc, prometheus.GaugeValue, 1, current,
+		)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
@@ -1,6 +1,9 @@
 package exporter
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -8,6 +11,7 @@ import (
 	"time"
 
 	"strings"
+	"sync"
 	"testing"
 
 	"net/http"
@@ -27,6 +31,16 @@ func init() {
 	log.Logger = zerolog.New(io.Discard)
 }
 func getTestServer() *httptest.Server {
+	return getFailingTestServer()
+}
+
+// getFailingTestServer returns a fake Awair device which responds with a 500
+// to any of the given paths.
+func getFailingTestServer(failPaths ...string) *httptest.Server {
+	return httptest.NewServer(testDeviceHandler(failPaths...))
+}
+
+func testDeviceHandler(failPaths ...string) http.Handler {
 	// Note: the docs at https://support.getawair.com/hc/en-us/articles/360049221014-Awair-Element-Local-API-Feature
 	// are incorrect about the type of `voc_feature_set`, the actual return is an int as here.
 	configData := `{
@@ -46,7 +60,7 @@ func getTestServer() *httptest.Server {
 		"voc_feature_set": 32
 	  }`
 	valuesData := `{
-		"timestamp": "",
+		"timestamp": "2023-01-20T18:05:36.452Z",
 		"score": 89,
 		"dew_point": 8.95,
 		"temp": 21.13,
@@ -62,7 +76,13 @@ func getTestServer() *httptest.Server {
 		"pm25": 40,
 		"pm10_est": 42
 	  }`
-	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range failPaths {
+			if r.URL.Path == p {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
 		switch r.URL.Path {
 		case "/settings/config/data":
 			fmt.Fprint(w, configData)
@@ -72,8 +92,7 @@ func getTestServer() *httptest.Server {
 			fmt.Printf("Unrecognized Path: %s", r.URL.Path)
 			fmt.Fprint(w, "Broken")
 		}
-	}))
-	return srv
+	})
 }
 
 func exporterFromTestServer(s *httptest.Server) (*AwairExporter, error) {
@@ -84,6 +103,10 @@ func exporterFromTestServer(s *httptest.Server) (*AwairExporter, error) {
 	return e, nil
 }
 
+func ptr(f float64) *float64 {
+	return &f
+}
+
 func TestNewAwairExporter_fail(t *testing.T) {
 	_, err := NewAwairExporter("not_a_real_host.not_a_host")
 	assert.NotNil(t, err)
@@ -92,26 +115,27 @@ func TestNewAwairExporter_fail(t *testing.T) {
 func TestGetMetrics(t *testing.T) {
 	assert := assert.New(t)
 	expected := &AwairValues{
-		Score:          89,
-		DewPoint:       8.95,
-		Temp:           21.13,
-		Humidity:       45.7,
-		AbsHumidity:    8.41,
-		CO2:            625,
-		CO2Est:         563,
-		CO2EstBaseline: 35252,
-		Voc:            60,
-		VocBaseline:    36539,
-		VocH2Raw:       25,
-		VocEthanolRaw:  36,
-		PM25:           40,
-		PM10Est:        42,
+		Timestamp:      "2023-01-20T18:05:36.452Z",
+		Score:          ptr(89),
+		DewPoint:       ptr(8.95),
+		Temp:           ptr(21.13),
+		Humidity:       ptr(45.7),
+		AbsHumidity:    ptr(8.41),
+		CO2:            ptr(625),
+		CO2Est:         ptr(563),
+		CO2EstBaseline: ptr(35252),
+		Voc:            ptr(60),
+		VocBaseline:    ptr(36539),
+		VocH2Raw:       ptr(25),
+		VocEthanolRaw:  ptr(36),
+		PM25:           ptr(40),
+		PM10Est:        ptr(42),
 	}
 	srv := getTestServer()
 	defer srv.Close()
 	e, err := exporterFromTestServer(srv)
 	assert.Nil(err)
-	metrics, err := e.GetMetrics()
+	metrics, err := e.GetMetrics(context.Background())
 	assert.Nil(err)
 	assert.Equal(expected, metrics, "Metrics don't match!")
 }
@@ -138,7 +162,7 @@ func TestGetConfig(t *testing.T) {
 	defer srv.Close()
 	e, err := exporterFromTestServer(srv)
 	assert.Nil(err)
-	config, err := e.GetConfig()
+	config, err := e.GetConfig(context.Background())
 	assert.Nil(err)
 	assert.Equal(expected, config, "Config doesn't match!")
 }
@@ -225,7 +249,17 @@ func TestAllMetricsPopulated(t *testing.T) {
 		{"co2_est_baseline_desc", regexp.MustCompile(`(?m)^# HELP awair_co2_est_baseline .*[a-zA-Z]+.*$`)},
 		{"co2_est_baseline", regexp.MustCompile(`(?m)^awair_co2_est_baseline.* +35252$`)},
 		{"device_info_desc", regexp.MustCompile(`(?m)^# HELP awair_device_info .*[a-zA-Z]+.*$`)},
-		{"device_info", regexp.MustCompile(`(?m)^awair_device_info{device_uuid=".+",firmware_version="1.+",voc_feature_set=".+".*} 1$`)},
+		{"device_info", regexp.MustCompile(`(?m)^awair_device_info{device_uuid=".+",firmware_version="1.+",timezone="America/Los_Angeles",voc_feature_set=".+".*} 1$`)},
+		{"network_info_desc", regexp.MustCompile(`(?m)^# HELP awair_network_info .*[a-zA-Z]+.*$`)},
+		{"network_info", regexp.MustCompile(`(?m)^awair_network_info{gateway="192.168.1.1",ip="192.168.1.2",netmask="255.255.255.0",ssid="Your_AP_Name_Here",wifi_mac="70:88:6B:00:00:00"} 1$`)},
+		{"led_brightness_desc", regexp.MustCompile(`(?m)^# HELP awair_led_brightness .*[a-zA-Z]+.*$`)},
+		{"led_brightness", regexp.MustCompile(`(?m)^awair_led_brightness 179$`)},
+		{"led_mode_desc", regexp.MustCompile(`(?m)^# HELP awair_led_mode .*[a-zA-Z]+.*$`)},
+		{"led_mode_current", regexp.MustCompile(`(?m)^awair_led_mode{mode="sleep"} 1$`)},
+		{"led_mode_other", regexp.MustCompile(`(?m)^awair_led_mode{mode="auto"} 0$`)},
+		{"display_mode_desc", regexp.MustCompile(`(?m)^# HELP awair_display_mode .*[a-zA-Z]+.*$`)},
+		{"display_mode_current", regexp.MustCompile(`(?m)^awair_display_mode{mode="score"} 1$`)},
+		{"display_mode_other", regexp.MustCompile(`(?m)^awair_display_mode{mode="temp"} 0$`)},
 		{"dew_point_desc", regexp.MustCompile(`(?m)^# HELP awair_dew_point .*[a-zA-Z]+.*$$`)},
 		{"dew_point", regexp.MustCompile(`(?m)^awair_dew_point.* 8.95$`)},
 		{"humidity_desc", regexp.MustCompile(`(?m)^# HELP awair_humidity .*[a-zA-Z]+.*$`)},
@@ -246,6 +280,15 @@ func TestAllMetricsPopulated(t *testing.T) {
 		{"voc_ethanol", regexp.MustCompile(`(?m)^awair_voc_ethanol_raw.* 36$`)},
 		{"voc_h2_desc", regexp.MustCompile(`(?m)^# HELP awair_voc_h2_raw .*[a-zA-Z]+.*$`)},
 		{"voc_h2", regexp.MustCompile(`(?m)^awair_voc_h2_raw.* 25$`)},
+		{"up", regexp.MustCompile(`(?m)^awair_up 1$`)},
+		{"sensor_present_desc", regexp.MustCompile(`(?m)^# HELP awair_sensor_present .*[a-zA-Z]+.*$`)},
+		{"sensor_present_co2", regexp.MustCompile(`(?m)^awair_sensor_present{sensor="co2"} 1$`)},
+		{"sensor_present_lux", regexp.MustCompile(`(?m)^awair_sensor_present{sensor="lux"} 0$`)},
+		{"reading_timestamp_desc", regexp.MustCompile(`(?m)^# HELP awair_reading_timestamp_seconds .*[a-zA-Z]+.*$`)},
+		{"reading_timestamp", regexp.MustCompile(`(?m)^awair_reading_timestamp_seconds 1\.674237936\d*e\+09$`)},
+		{"scrape_timeout", regexp.MustCompile(`(?m)^awair_scrape_timeout 0$`)},
+		{"scrape_success_air_data", regexp.MustCompile(`(?m)^awair_scrape_success{endpoint="air-data"} 1$`)},
+		{"scrape_success_config", regexp.MustCompile(`(?m)^awair_scrape_success{endpoint="config"} 1$`)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.desc, func(t *testing.T) {
@@ -253,3 +296,384 @@ func TestAllMetricsPopulated(t *testing.T) {
 		})
 	}
 }
+
+func TestCollect_FetchFailures(t *testing.T) {
+	cases := []struct {
+		name             string
+		failPaths        []string
+		expectUp         float64
+		expectAirData    float64
+		expectConfig     float64
+		expectSensors    bool
+		expectDeviceInfo bool
+	}{
+		{"all_ok", nil, 1, 1, 1, true, true},
+		{"air_data_fails", []string{"/air-data/latest"}, 0, 0, 1, false, true},
+		{"config_fails", []string{"/settings/config/data"}, 0, 1, 0, true, false},
+		{"both_fail", []string{"/air-data/latest", "/settings/config/data"}, 0, 0, 0, false, false},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			srv := getFailingTestServer(cse.failPaths...)
+			defer srv.Close()
+			e := &AwairExporter{hostname: strings.Replace(srv.URL, "http://", "", -1)}
+
+			reg := prometheus.NewPedanticRegistry()
+			reg.MustRegister(e)
+			families, err := reg.Gather()
+			require.Nil(err)
+
+			got := map[string]*dto.MetricFamily{}
+			for _, mf := range families {
+				got[mf.GetName()] = mf
+			}
+
+			require.Contains(got, "awair_up")
+			assert.Equal(cse.expectUp, got["awair_up"].GetMetric()[0].GetGauge().GetValue())
+
+			require.Contains(got, "awair_scrape_success")
+			success := map[string]float64{}
+			for _, m := range got["awair_scrape_success"].GetMetric() {
+				success[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			}
+			assert.Equal(map[string]float64{
+				"air-data": cse.expectAirData,
+				"config":   cse.expectConfig,
+			}, success)
+
+			for _, name := range []string{"awair_score", "awair_temp", "awair_co2", "awair_pm25"} {
+				_, ok := got[name]
+				assert.Equal(cse.expectSensors, ok, "presence of %s", name)
+			}
+			_, ok := got["awair_device_info"]
+			assert.Equal(cse.expectDeviceInfo, ok, "presence of awair_device_info")
+		})
+	}
+}
+
+func TestCollect_Timeout(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+	e := &AwairExporter{
+		hostname: strings.Replace(srv.URL, "http://", "", -1),
+		timeout:  50 * time.Millisecond,
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(e)
+	start := time.Now()
+	families, err := reg.Gather()
+	require.Nil(err)
+	assert.Less(time.Since(start), 500*time.Millisecond)
+
+	got := map[string]float64{}
+	for _, mf := range families {
+		if len(mf.GetMetric()) == 1 {
+			got[mf.GetName()] = mf.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	assert.Equal(float64(1), got["awair_scrape_timeout"])
+	assert.Equal(float64(0), got["awair_up"])
+}
+
+func TestNewAwairExporter_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	_, err := NewAwairExporter(
+		strings.Replace(srv.URL, "http://", "", -1),
+		WithTimeout(50*time.Millisecond),
+	)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded, got %v", err)
+}
+
+func TestReadingTime(t *testing.T) {
+	assert := assert.New(t)
+	v := &AwairValues{Timestamp: "2023-01-20T18:05:36.452Z"}
+	ts, err := v.ReadingTime()
+	assert.Nil(err)
+	assert.Equal(time.Date(2023, 1, 20, 18, 5, 36, 452000000, time.UTC), ts)
+
+	_, err = (&AwairValues{}).ReadingTime()
+	assert.NotNil(err)
+	_, err = (&AwairValues{Timestamp: "yesterday"}).ReadingTime()
+	assert.NotNil(err)
+}
+
+func TestCheckReadingTime(t *testing.T) {
+	fetched := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		reading   time.Time
+		expectErr bool
+	}{
+		{"in_sync", fetched.Add(-10 * time.Second), false},
+		{"slightly_ahead", fetched.Add(time.Minute), false},
+		{"far_behind", fetched.Add(-time.Hour), true},
+		{"far_ahead", fetched.Add(time.Hour), true},
+		{"never_synced", time.Unix(0, 0), true},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			err := checkReadingTime(cse.reading, fetched)
+			if cse.expectErr {
+				assert.True(t, errors.Is(err, ErrClockSkew), "expected ErrClockSkew, got %v", err)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestCollect_ReadingTimestamps(t *testing.T) {
+	readingTime := time.Now().Add(-5 * time.Second).UTC().Truncate(time.Millisecond)
+	cases := []struct {
+		name        string
+		timestamp   string
+		enabled     bool
+		expectStamp bool
+		expectValid float64
+	}{
+		{"disabled", readingTime.Format(time.RFC3339Nano), false, false, 1},
+		{"disabled_clock_wrong", "1970-01-01T00:02:10.000Z", false, false, 0},
+		{"enabled", readingTime.Format(time.RFC3339Nano), true, true, 1},
+		{"enabled_clock_wrong", "1970-01-01T00:02:10.000Z", true, false, 0},
+		{"enabled_missing", "", true, false, 0},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/settings/config/data":
+					fmt.Fprint(w, `{"device_uuid": "awair-element_1"}`)
+				case "/air-data/latest":
+					fmt.Fprintf(w, `{"timestamp": %q, "score": 89}`, cse.timestamp)
+				}
+			}))
+			defer srv.Close()
+			e := newAwairExporter(
+				strings.Replace(srv.URL, "http://", "", -1),
+				WithReadingTimestamps(cse.enabled),
+			)
+
+			got := gatherCollector(t, e)
+			require.Contains(got, "awair_reading_timestamp_valid")
+			assert.Equal(cse.expectValid, got["awair_reading_timestamp_valid"].GetMetric()[0].GetGauge().GetValue())
+			require.Contains(got, "awair_score")
+			m := got["awair_score"].GetMetric()[0]
+			if cse.expectStamp {
+				assert.Equal(readingTime.UnixMilli(), m.GetTimestampMs())
+			} else {
+				assert.Nil(m.TimestampMs)
+			}
+		})
+	}
+}
+
+func TestCollect_ReadingTimestampsLogged(t *testing.T) {
+	assert := assert.New(t)
+	var mu sync.Mutex
+	timestamp := "1970-01-01T00:02:10.000Z"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			fmt.Fprint(w, `{"device_uuid": "awair-element_1"}`)
+		case "/air-data/latest":
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(w, `{"timestamp": %q, "score": 89}`, timestamp)
+		}
+	}))
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(zerolog.SyncWriter(&logs))
+	defer func() { log.Logger = logger }()
+
+	scrape := func() {
+		gatherCollector(t, newAwairExporter(hostname, WithReadingTimestamps(true)))
+	}
+	// A wrong clock is only logged when it's noticed, and when it's fixed.
+	scrape()
+	scrape()
+	assert.Equal(1, strings.Count(logs.String(), "Not using the device's reading timestamp"))
+
+	mu.Lock()
+	timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	mu.Unlock()
+	scrape()
+	scrape()
+	assert.Equal(1, strings.Count(logs.String(), "Not using the device's reading timestamp"))
+	assert.Equal(1, strings.Count(logs.String(), "Using the device's reading timestamp again"))
+}
+
+func TestCollectStateSet_UnknownState(t *testing.T) {
+	assert := assert.New(t)
+	ch := make(chan prometheus.Metric, 10)
+	collectStateSet(ch, led_mode, ledModes, "disco")
+	close(ch)
+
+	got := map[string]float64{}
+	for m := range ch {
+		metric := &dto.Metric{}
+		assert.Nil(m.Write(metric))
+		got[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+	}
+	assert.Equal(map[string]float64{"auto": 0, "manual": 0, "sleep": 0, "disco": 1}, got)
+}
+
+func TestCollect_OptionalSensors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			fmt.Fprint(w, `{"device_uuid": "awair-element_1"}`)
+		case "/air-data/latest":
+			fmt.Fprint(w, `{"score": 97, "temp": 20.5, "pm25": 0}`)
+		}
+	}))
+	defer srv.Close()
+	e := newAwairExporter(strings.Replace(srv.URL, "http://", "", -1))
+
+	got := gatherCollector(t, e)
+	require.Contains(got, "awair_pm25")
+	assert.Equal(float64(0), got["awair_pm25"].GetMetric()[0].GetGauge().GetValue())
+	assert.Contains(got, "awair_score")
+	assert.Contains(got, "awair_temp")
+	for _, name := range []string{"awair_co2", "awair_voc", "awair_humidity", "awair_pm10"} {
+		assert.NotContains(got, name)
+	}
+
+	require.Contains(got, "awair_sensor_present")
+	present := map[string]float64{}
+	for _, m := range got["awair_sensor_present"].GetMetric() {
+		present[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+	}
+	assert.Equal(len(sensors), len(present))
+	assert.Equal(float64(1), present["pm25"])
+	assert.Equal(float64(1), present["temp"])
+	assert.Equal(float64(0), present["co2"])
+	assert.Equal(float64(0), present["humid"])
+}
+
+func TestCollect_MetricGroups(t *testing.T) {
+	srv := getTestServer()
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	cases := []struct {
+		name    string
+		groups  []MetricGroup
+		present []string
+		absent  []string
+	}{
+		{"all", nil, []string{"awair_score", "awair_sensor_present", "awair_device_info"}, nil},
+		{"sensors", []MetricGroup{GroupSensors}, []string{"awair_score", "awair_sensor_present"}, []string{"awair_device_info", "awair_led_mode"}},
+		{"device", []MetricGroup{GroupDevice}, []string{"awair_device_info", "awair_led_mode"}, []string{"awair_score", "awair_sensor_present"}},
+	}
+	for _, cse := range cases {
+		t.Run(cse.name, func(t *testing.T) {
+			assert := assert.New(t)
+			e := newAwairExporter(hostname, WithMetricGroups(cse.groups...))
+			got := gatherCollector(t, e)
+			for _, name := range append(cse.present, "awair_up", "awair_scrape_success") {
+				assert.Contains(got, name)
+			}
+			for _, name := range cse.absent {
+				assert.NotContains(got, name)
+			}
+		})
+	}
+}
+
+func TestParseMetricGroup(t *testing.T) {
+	assert := assert.New(t)
+	for _, g := range MetricGroups {
+		got, err := ParseMetricGroup(string(g))
+		assert.Nil(err)
+		assert.Equal(g, got)
+	}
+	_, err := ParseMetricGroup("everything")
+	assert.NotNil(err)
+}
+
+func TestCollect_UnitSystem(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			fmt.Fprint(w, `{"device_uuid": "awair-element_1"}`)
+		case "/air-data/latest":
+			fmt.Fprint(w, `{"temp": 20, "dew_point": -10, "abs_humid": 10, "humid": 40}`)
+		}
+	}))
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	metric := []string{"awair_temp", "awair_dew_point", "awair_absolute_humidity"}
+	cases := []struct {
+		units  UnitSystem
+		want   map[string]float64
+		absent []string
+		temp   string
+		help   string
+	}{
+		{UnitsMetric, map[string]float64{"awair_temp": 20, "awair_dew_point": -10, "awair_absolute_humidity": 10, "awair_humidity": 40}, nil, "awair_temp", "Dry bulb temperature (ºC)"},
+		// A metric name never carries another unit.
+		{UnitsImperial, map[string]float64{"awair_temp_fahrenheit": 68, "awair_dew_point_fahrenheit": 14, "awair_absolute_humidity_grains_per_cubic_foot": 4.3699572, "awair_humidity": 40}, metric, "awair_temp_fahrenheit", "Dry bulb temperature (ºF)"},
+	}
+	for _, cse := range cases {
+		t.Run(string(cse.units), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			got := gatherCollector(t, newAwairExporter(hostname, WithUnitSystem(cse.units)))
+			for name, want := range cse.want {
+				require.Contains(got, name)
+				assert.InDelta(want, got[name].GetMetric()[0].GetGauge().GetValue(), 1e-9, name)
+			}
+			for _, name := range cse.absent {
+				assert.NotContains(got, name)
+			}
+			assert.Equal(cse.help, got[cse.temp].GetHelp())
+		})
+	}
+}
+
+func TestParseUnitSystem(t *testing.T) {
+	assert := assert.New(t)
+	for s, want := range map[string]UnitSystem{"": UnitsMetric, "metric": UnitsMetric, "imperial": UnitsImperial} {
+		got, err := ParseUnitSystem(s)
+		assert.Nil(err)
+		assert.Equal(want, got)
+	}
+	_, err := ParseUnitSystem("kelvin")
+	assert.NotNil(err)
+}
+
+func TestIsReservedLabel(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{"endpoint", "field", "mode", "sensor", "model", "firmware_version", "ssid", "gateway"} {
+		assert.True(IsReservedLabel(name), name)
+	}
+	for _, name := range []string{"room", "floor", "building", "team"} {
+		assert.False(IsReservedLabel(name), name)
+	}
+}
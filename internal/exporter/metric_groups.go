@@ -0,0 +1,42 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetricGroup is a set of metrics which can be left out of a scrape. The
+// status metrics (awair_up, awair_scrape_success and awair_scrape_timeout)
+// aren't in any group, and are always exported.
+type MetricGroup string
+
+const (
+	// GroupSensors is the sensor readings, awair_sensor_present and
+	// awair_reading_timestamp_seconds.
+	GroupSensors MetricGroup = "sensors"
+	// GroupDevice is awair_device_info, awair_network_info and the LED and
+	// display settings.
+	GroupDevice MetricGroup = "device"
+	// GroupRaw is awair_raw, when raw fields are enabled.
+	GroupRaw MetricGroup = "raw"
+)
+
+// MetricGroups lists every metric group.
+var MetricGroups = []MetricGroup{GroupSensors, GroupDevice, GroupRaw}
+
+// ParseMetricGroup returns the metric group called s.
+func ParseMetricGroup(s string) (MetricGroup, error) {
+	names := make([]string, len(MetricGroups))
+	for i, g := range MetricGroups {
+		if string(g) == s {
+			return g, nil
+		}
+		names[i] = string(g)
+	}
+	return "", fmt.Errorf("unknown metric group %q, must be one of %s", s, strings.Join(names, ", "))
+}
+
+// exports reports whether the exporter exports the metrics in group.
+func (e *AwairExporter) exports(group MetricGroup) bool {
+	return e.groups == nil || e.groups[group]
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import "strings"
+
+// Model is the kind of Awair device, as encoded in the prefix of its device_uuid.
+type Model string
+
+const (
+	ModelElement    Model = "awair-element"
+	ModelOmni       Model = "awair-omni"
+	ModelMint       Model = "awair-mint"
+	Model2ndEdition Model = "awair-r2"
+	ModelGlowC      Model = "awair-glow-c"
+	ModelUnknown    Model = "unknown"
+)
+
+// uuidSeparator separates the model from the serial in a device_uuid.
+const uuidSeparator = "_"
+
+var knownModels = []Model{
+	ModelElement,
+	ModelOmni,
+	ModelMint,
+	Model2ndEdition,
+	ModelGlowC,
+}
+
+// ModelFromUUID returns the model of the device with the given device_uuid,
+// e.g. "awair-omni_4221" is an Omni.
+func ModelFromUUID(uuid string) Model {
+	prefix, _, found := strings.Cut(uuid, uuidSeparator)
+	if !found {
+		return ModelUnknown
+	}
+	for _, m := range knownModels {
+		if Model(prefix) == m {
+			return m
+		}
+	}
+	return ModelUnknown
+}
+
+// Model returns the model of the device, detected from its device_uuid.
+func (c *ConfigResponse) Model() Model {
+	return ModelFromUUID(c.DeviceUUID)
+}
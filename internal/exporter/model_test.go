@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+// getFixtureServer returns a fake Awair device serving the responses in
+// testdata/<fixture>.
+func getFixtureServer(t *testing.T, fixture string) *httptest.Server {
+	config, err := os.ReadFile(filepath.Join("testdata", fixture, "config.json"))
+	require.Nil(t, err)
+	airData, err := os.ReadFile(filepath.Join("testdata", fixture, "air-data.json"))
+	require.Nil(t, err)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			w.Write(config)
+		case "/air-data/latest":
+			w.Write(airData)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestModelFromUUID(t *testing.T) {
+	cases := []struct {
+		uuid     string
+		expected Model
+	}{
+		{"awair-element_1", ModelElement},
+		{"awair-omni_4221", ModelOmni},
+		{"awair-mint_77", ModelMint},
+		{"awair-r2_13", Model2ndEdition},
+		{"awair-glow-c_5", ModelGlowC},
+		{"awair-toaster_1", ModelUnknown},
+		{"awair-element", ModelUnknown},
+		{"", ModelUnknown},
+	}
+	for _, cse := range cases {
+		t.Run(cse.uuid, func(t *testing.T) {
+			assert.Equal(t, cse.expected, ModelFromUUID(cse.uuid))
+		})
+	}
+}
+
+func TestCollect_Models(t *testing.T) {
+	cases := []struct {
+		fixture  string
+		model    Model
+		expected map[string]float64
+		absent   []string
+	}{
+		{
+			fixture:  "element",
+			model:    ModelElement,
+			expected: map[string]float64{"awair_score": 89, "awair_pm25": 40},
+			absent:   []string{"awair_lux", "awair_spl_a", "awair_dust"},
+		},
+		{
+			fixture:  "omni",
+			model:    ModelOmni,
+			expected: map[string]float64{"awair_score": 92, "awair_lux": 312.5, "awair_spl_a": 48.3},
+			absent:   []string{"awair_dust"},
+		},
+		{
+			fixture:  "mint",
+			model:    ModelMint,
+			expected: map[string]float64{"awair_score": 95, "awair_lux": 120},
+			absent:   []string{"awair_spl_a", "awair_dust"},
+		},
+		{
+			fixture:  "2nd-edition",
+			model:    Model2ndEdition,
+			expected: map[string]float64{"awair_score": 81, "awair_dust": 14},
+			absent:   []string{"awair_lux", "awair_spl_a"},
+		},
+	}
+	for _, cse := range cases {
+		t.Run(cse.fixture, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			srv := getFixtureServer(t, cse.fixture)
+			defer srv.Close()
+			e, err := NewAwairExporter(strings.Replace(srv.URL, "http://", "", -1))
+			require.Nil(err)
+
+			got := gatherCollector(t, e)
+			for name, value := range cse.expected {
+				require.Contains(got, name)
+				assert.Equal(value, got[name].GetMetric()[0].GetGauge().GetValue(), name)
+			}
+			for _, name := range cse.absent {
+				assert.NotContains(got, name)
+			}
+
+			require.Contains(got, "awair_device_info")
+			labels := map[string]string{}
+			for _, l := range got["awair_device_info"].GetMetric()[0].GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			assert.Equal(string(cse.model), labels["model"])
+		})
+	}
+}
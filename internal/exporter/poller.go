@@ -0,0 +1,261 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultPollInterval is how often a polled target is scraped when no
+// interval is configured for it.
+const DefaultPollInterval = 30 * time.Second
+
+var (
+	last_success_timestamp = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "last_success_timestamp_seconds"),
+		"Unix timestamp of the last poll which fetched every endpoint of the Awair device",
+		nil,
+		nil,
+	)
+
+	data_age = prometheus.NewDesc(
+		prometheus.BuildFQName("awair", "", "data_age_seconds"),
+		"Seconds since the served readings were fetched from the Awair device",
+		nil,
+		nil,
+	)
+)
+
+// staleIntervals is how many poll intervals the last good readings of a
+// target are served for once polls start failing.
+const staleIntervals = 5
+
+type pollTarget struct {
+	cancel   context.CancelFunc
+	interval time.Duration
+	exporter *AwairExporter
+
+	mu          sync.RWMutex
+	last        *Sample
+	values      *AwairValues
+	valuesTime  time.Time
+	config      *ConfigResponse
+	lastSuccess time.Time
+}
+
+// Poller scrapes each of its targets in the background on the target's own
+// interval, and keeps the latest result in memory. Probes for a polled target
+// are served from memory, so the number of requests a device sees doesn't
+// depend on how many times, or by how many Prometheus servers, it's probed.
+type Poller struct {
+	opts []Option
+	now  func() time.Time
+
+	mu      sync.Mutex
+	targets map[string]*pollTarget
+}
+
+// NewPoller returns a Poller which builds each target's exporter with opts.
+func NewPoller(opts ...Option) *Poller {
+	return &Poller{
+		opts:    opts,
+		now:     time.Now,
+		targets: map[string]*pollTarget{},
+	}
+}
+
+// PollTarget is how a target is polled.
+type PollTarget struct {
+	Interval time.Duration
+	// Options configure the target's exporter on top of the poller's own,
+	// e.g. WithBasicAuth.
+	Options []Option
+}
+
+// Add starts polling target every interval until ctx is done or the target is
+// removed. Adding a target which is already polled restarts it with the new
+// interval. opts configure the target's exporter on top of the poller's own.
+func (p *Poller) Add(ctx context.Context, target string, interval time.Duration, opts ...Option) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	t := &pollTarget{
+		cancel:   cancel,
+		interval: interval,
+		exporter: newAwairExporter(target, append(append([]Option{}, p.opts...), opts...)...),
+	}
+
+	p.mu.Lock()
+	if old, ok := p.targets[target]; ok {
+		old.cancel()
+	}
+	p.targets[target] = t
+	p.mu.Unlock()
+
+	log.Info().
+		Str("target", target).
+		Dur("interval", interval).
+		Msg("Polling Awair device.")
+	go p.poll(ctx, t)
+}
+
+// Sync makes the polled targets match targets. Targets already polled at the
+// same interval keep their state, and their options; Remove a target first to
+// apply new options to it.
+func (p *Poller) Sync(ctx context.Context, targets map[string]PollTarget) {
+	p.mu.Lock()
+	var stale []string
+	for target, t := range p.targets {
+		pt, ok := targets[target]
+		if !ok || (pt.Interval > 0 && pt.Interval != t.interval) {
+			stale = append(stale, target)
+		}
+	}
+	p.mu.Unlock()
+	for _, target := range stale {
+		p.Remove(target)
+	}
+
+	for target, pt := range targets {
+		p.mu.Lock()
+		_, ok := p.targets[target]
+		p.mu.Unlock()
+		if !ok {
+			p.Add(ctx, target, pt.Interval, pt.Options...)
+		}
+	}
+}
+
+// Remove stops polling target and forgets its last readings.
+func (p *Poller) Remove(target string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.targets[target]; ok {
+		t.cancel()
+		delete(p.targets, target)
+	}
+}
+
+// Stop stops polling every target.
+func (p *Poller) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for target, t := range p.targets {
+		t.cancel()
+		delete(p.targets, target)
+	}
+}
+
+// Targets returns every target being polled.
+func (p *Poller) Targets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	targets := make([]string, 0, len(p.targets))
+	for target := range p.targets {
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// Collector returns a collector serving the latest readings of target, or
+// false if target isn't polled. opts change how the readings are exported,
+// e.g. WithMetricGroups, without affecting the polling itself.
+func (p *Poller) Collector(target string, opts ...Option) (prometheus.Collector, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.targets[target]
+	if !ok {
+		return nil, false
+	}
+	view := *t.exporter
+	for _, opt := range opts {
+		opt(&view)
+	}
+	return &polledCollector{target: t, exporter: &view, now: p.now}, true
+}
+
+func (p *Poller) poll(ctx context.Context, t *pollTarget) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		sample := t.exporter.Scrape(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		t.mu.Lock()
+		t.last = sample
+		if sample.ValuesErr == nil {
+			t.values, t.valuesTime = sample.Values, sample.Time
+		}
+		if sample.ConfigErr == nil {
+			t.config = sample.Config
+		}
+		if sample.Success() {
+			t.lastSuccess = sample.Time
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// polledCollector serves a polled target's readings. The status metrics
+// (awair_up etc.) reflect the latest poll, while the readings are the latest
+// ones fetched successfully, so a single failed poll doesn't blank dashboards.
+// Readings older than staleIntervals poll intervals are dropped.
+type polledCollector struct {
+	target   *pollTarget
+	exporter *AwairExporter
+	now      func() time.Time
+}
+
+func (c *polledCollector) Describe(ch chan<- *prometheus.Desc) {
+	if c.exporter.labelsDevice() {
+		return
+	}
+	c.exporter.Describe(ch)
+	ch <- last_success_timestamp
+	ch <- data_age
+}
+
+func (c *polledCollector) Collect(ch chan<- prometheus.Metric) {
+	t := c.target
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.last == nil {
+		// The first poll hasn't finished yet.
+		return
+	}
+	c.exporter.collectDevice(ch, t.config, c.collect)
+}
+
+func (c *polledCollector) collect(ch chan<- prometheus.Metric) {
+	t := c.target
+	collectStatus(ch, t.last)
+	if t.config != nil {
+		c.exporter.collectConfig(ch, t.config)
+	}
+	if t.values != nil {
+		age := c.now().Sub(t.valuesTime)
+		if age <= staleIntervals*t.interval {
+			c.exporter.collectValues(ch, t.values, t.valuesTime)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			data_age, prometheus.GaugeValue, age.Seconds(),
+		)
+	}
+	if !t.lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			last_success_timestamp, prometheus.GaugeValue, float64(t.lastSuccess.UnixNano())/1e9,
+		)
+	}
+}
@@ -0,0 +1,173 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func gatherCollector(t *testing.T, c prometheus.Collector) map[string]*dto.MetricFamily {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	require.Nil(t, err)
+	got := map[string]*dto.MetricFamily{}
+	for _, mf := range families {
+		got[mf.GetName()] = mf
+	}
+	return got
+}
+
+func TestPoller_ServesFromMemory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := newCountingServer(testDeviceHandler())
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	p := NewPoller()
+	defer p.Stop()
+	p.Add(context.Background(), hostname, time.Hour)
+
+	c, ok := p.Collector(hostname)
+	require.True(ok)
+	require.Eventually(func() bool {
+		_, ok := gatherCollector(t, c)["awair_up"]
+		return ok
+	}, time.Second, 5*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		got := gatherCollector(t, c)
+		require.Contains(got, "awair_score")
+		assert.Equal(float64(89), got["awair_score"].GetMetric()[0].GetGauge().GetValue())
+		require.Contains(got, "awair_data_age_seconds")
+		require.Contains(got, "awair_last_success_timestamp_seconds")
+		assert.Greater(got["awair_last_success_timestamp_seconds"].GetMetric()[0].GetGauge().GetValue(), float64(0))
+	}
+	assert.Equal(1, srv.count("/air-data/latest"))
+
+	_, ok = p.Collector("not-polled")
+	assert.False(ok)
+}
+
+func TestPoller_StaleReadings(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	var failing atomic.Bool
+	ok := testDeviceHandler()
+	broken := testDeviceHandler("/air-data/latest")
+	srv := newCountingServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			broken.ServeHTTP(w, r)
+			return
+		}
+		ok.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	interval := 20 * time.Millisecond
+	p := NewPoller()
+	now := time.Now()
+	var offset atomic.Int64
+	p.now = func() time.Time { return now.Add(time.Duration(offset.Load())) }
+	defer p.Stop()
+	p.Add(context.Background(), hostname, interval)
+	c, _ := p.Collector(hostname)
+
+	require.Eventually(func() bool {
+		_, ok := gatherCollector(t, c)["awair_score"]
+		return ok
+	}, time.Second, 5*time.Millisecond)
+
+	failing.Store(true)
+	require.Eventually(func() bool {
+		got := gatherCollector(t, c)
+		return got["awair_up"].GetMetric()[0].GetGauge().GetValue() == 0
+	}, time.Second, 5*time.Millisecond)
+
+	// The last good readings are still served while fresh enough...
+	got := gatherCollector(t, c)
+	assert.Contains(got, "awair_score")
+
+	// ...and dropped once they are too old.
+	offset.Store(int64(time.Hour))
+	got = gatherCollector(t, c)
+	assert.NotContains(got, "awair_score")
+	require.Contains(got, "awair_data_age_seconds")
+	assert.Greater(got["awair_data_age_seconds"].GetMetric()[0].GetGauge().GetValue(), float64(3000))
+}
+
+func TestPoller_Remove(t *testing.T) {
+	assert := assert.New(t)
+	srv := newCountingServer(testDeviceHandler())
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	p := NewPoller()
+	p.Add(context.Background(), hostname, time.Hour)
+	assert.Equal([]string{hostname}, p.Targets())
+
+	p.Remove(hostname)
+	_, ok := p.Collector(hostname)
+	assert.False(ok)
+	assert.Empty(p.Targets())
+}
+
+func TestPoller_Sync(t *testing.T) {
+	assert := assert.New(t)
+	srv := newCountingServer(testDeviceHandler())
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	p := NewPoller()
+	defer p.Stop()
+	p.Sync(context.Background(), map[string]PollTarget{hostname: {Interval: time.Hour}, "other": {Interval: time.Hour}})
+	assert.ElementsMatch([]string{hostname, "other"}, p.Targets())
+	kept, _ := p.Collector(hostname)
+
+	p.Sync(context.Background(), map[string]PollTarget{hostname: {Interval: time.Hour}})
+	assert.Equal([]string{hostname}, p.Targets())
+	same, _ := p.Collector(hostname)
+	assert.Equal(kept.(*polledCollector).target, same.(*polledCollector).target)
+
+	p.Sync(context.Background(), map[string]PollTarget{hostname: {Interval: time.Minute}})
+	restarted, _ := p.Collector(hostname)
+	assert.NotEqual(kept.(*polledCollector).target, restarted.(*polledCollector).target)
+	assert.Equal(time.Minute, restarted.(*polledCollector).target.interval)
+}
+
+func TestPoller_CollectorOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	srv := newCountingServer(testDeviceHandler())
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	p := NewPoller()
+	defer p.Stop()
+	p.Add(context.Background(), hostname, time.Hour)
+
+	full, ok := p.Collector(hostname)
+	require.True(ok)
+	require.Eventually(func() bool {
+		_, ok := gatherCollector(t, full)["awair_score"]
+		return ok
+	}, time.Second, 5*time.Millisecond)
+
+	device, ok := p.Collector(hostname, WithMetricGroups(GroupDevice))
+	require.True(ok)
+	got := gatherCollector(t, device)
+	assert.Contains(got, "awair_device_info")
+	assert.NotContains(got, "awair_score")
+	assert.Contains(gatherCollector(t, full), "awair_score")
+	assert.Equal(1, srv.count("/air-data/latest"))
+}
@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var raw = prometheus.NewDesc(
+	prometheus.BuildFQName("awair", "", "raw"),
+	"Numeric field from /air-data/latest which this version of the exporter doesn't know about",
+	[]string{"field"},
+	nil,
+)
+
+// RawFields passes numeric fields of /air-data/latest which the exporter
+// doesn't otherwise know about through as awair_raw{field="..."}, so readings
+// added by new firmware can be graphed before the exporter supports them.
+// The first time a target reports a new field, it's logged.
+type RawFields struct {
+	deny map[string]bool
+
+	mu   sync.Mutex
+	seen map[string]map[string]bool
+}
+
+// NewRawFields returns a RawFields which never exports the fields in deny.
+func NewRawFields(deny []string) *RawFields {
+	r := &RawFields{
+		deny: map[string]bool{},
+		seen: map[string]map[string]bool{},
+	}
+	for _, field := range deny {
+		r.deny[field] = true
+	}
+	return r
+}
+
+// collect emits the unknown fields of values reported by target.
+func (r *RawFields) collect(ch chan<- prometheus.Metric, target string, values *AwairValues) {
+	fields := make([]string, 0, len(values.Unknown))
+	for field := range values.Unknown {
+		if !r.deny[field] {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	r.mu.Lock()
+	seen, ok := r.seen[target]
+	if !ok {
+		seen = map[string]bool{}
+		r.seen[target] = seen
+	}
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			log.Info().
+				Str("target", target).
+				Str("field", field).
+				Msg("Awair device reported an unknown field, exporting it as awair_raw.")
+		}
+	}
+	r.mu.Unlock()
+
+	for _, field := range fields {
+		ch <- prometheus.MustNewConstMetric(
+			raw, prometheus.GaugeValue, values.Unknown[field], field,
+		)
+	}
+}
+
+// unknownFields returns the numeric fields of an /air-data/latest response
+// which don't map to a known sensor.
+func unknownFields(body []byte) (map[string]float64, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	var unknown map[string]float64
+	for field, value := range fields {
+		if knownFields[field] {
+			continue
+		}
+		var f float64
+		if err := json.Unmarshal(value, &f); err != nil {
+			// Not a number, so it can't be a metric.
+			continue
+		}
+		if unknown == nil {
+			unknown = map[string]float64{}
+		}
+		unknown[field] = f
+	}
+	return unknown, nil
+}
+
+// knownFields are the fields of /air-data/latest decoded into AwairValues.
+var knownFields = func() map[string]bool {
+	known := map[string]bool{"timestamp": true}
+	for _, sensor := range sensors {
+		known[sensor.name] = true
+	}
+	return known
+}()
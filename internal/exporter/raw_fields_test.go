@@ -0,0 +1,81 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+	"github.com/tj/assert"
+)
+
+func TestUnknownFields(t *testing.T) {
+	assert := assert.New(t)
+	unknown, err := unknownFields([]byte(`{
+		"timestamp": "2023-01-20T18:05:36.452Z",
+		"score": 89,
+		"co2": 625,
+		"radon": 12.5,
+		"pm1": 3,
+		"sensor_state": "warming_up",
+		"flags": [1, 2]
+	}`))
+	assert.Nil(err)
+	assert.Equal(map[string]float64{"radon": 12.5, "pm1": 3}, unknown)
+
+	unknown, err = unknownFields([]byte(`{"score": 89}`))
+	assert.Nil(err)
+	assert.Nil(unknown)
+
+	_, err = unknownFields([]byte(`[]`))
+	assert.NotNil(err)
+}
+
+func TestCollect_RawFields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings/config/data":
+			fmt.Fprint(w, `{"device_uuid": "awair-element_1"}`)
+		case "/air-data/latest":
+			fmt.Fprint(w, `{"score": 89, "radon": 12.5, "pm1": 3, "secret": 7}`)
+		}
+	}))
+	defer srv.Close()
+	hostname := strings.Replace(srv.URL, "http://", "", -1)
+
+	t.Run("disabled", func(t *testing.T) {
+		got := gatherCollector(t, newAwairExporter(hostname))
+		assert.NotContains(t, got, "awair_raw")
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		var logs bytes.Buffer
+		logger := log.Logger
+		log.Logger = zerolog.New(zerolog.SyncWriter(&logs))
+		defer func() { log.Logger = logger }()
+
+		rawFields := NewRawFields([]string{"secret"})
+		for i := 0; i < 2; i++ {
+			got := gatherCollector(t, newAwairExporter(hostname, WithRawFields(rawFields)))
+			require.Contains(got, "awair_raw")
+			fields := map[string]float64{}
+			for _, m := range got["awair_raw"].GetMetric() {
+				fields[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			}
+			assert.Equal(map[string]float64{"radon": 12.5, "pm1": 3}, fields)
+			assert.Contains(got, "awair_score")
+		}
+		// Each new field is only logged once per target.
+		assert.Equal(1, strings.Count(logs.String(), `"field":"radon"`))
+		assert.Equal(1, strings.Count(logs.String(), `"field":"pm1"`))
+		assert.NotContains(logs.String(), "secret")
+	})
+}
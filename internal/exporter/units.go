@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UnitSystem selects the units readings are exported in. The device always
+// reports metric units.
+type UnitSystem string
+
+const (
+	UnitsMetric   UnitSystem = "metric"
+	UnitsImperial UnitSystem = "imperial"
+)
+
+// ParseUnitSystem returns the unit system called s. An empty s is metric.
+func ParseUnitSystem(s string) (UnitSystem, error) {
+	switch UnitSystem(s) {
+	case "", UnitsMetric:
+		return UnitsMetric, nil
+	case UnitsImperial:
+		return UnitsImperial, nil
+	}
+	return "", fmt.Errorf("unknown unit system %q, must be %q or %q", s, UnitsMetric, UnitsImperial)
+}
+
+// gramsPerCubicMetreInGrains converts g/m³ to grains per cubic foot.
+const gramsPerCubicMetreInGrains = 0.43699572
+
+// conversion is the imperial version of a sensor's metric.
+type conversion struct {
+	desc    *prometheus.Desc
+	convert func(float64) float64
+}
+
+func celsiusToFahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
+
+// imperialSensors maps the name of each sensor reported in metric units to its
+// imperial version. The unit is part of the metric name, so a series never
+// changes units with the module it's probed with, and dashboards and alerts
+// reading the metric version aren't fed ºF.
+var imperialSensors = map[string]conversion{
+	"dew_point": {
+		prometheus.NewDesc(
+			prometheus.BuildFQName("awair", "", "dew_point_fahrenheit"),
+			"The temperature at which water will condense and form into dew (ºF)",
+			nil,
+			nil,
+		),
+		celsiusToFahrenheit,
+	},
+	"temp": {
+		prometheus.NewDesc(
+			prometheus.BuildFQName("awair", "", "temp_fahrenheit"),
+			"Dry bulb temperature (ºF)",
+			nil,
+			nil,
+		),
+		celsiusToFahrenheit,
+	},
+	"heat_index": {
+		prometheus.NewDesc(
+			prometheus.BuildFQName("awair", "", "heat_index_fahrenheit"),
+			"Heat index, how hot the air feels given its humidity, per the US National Weather Service (ºF)",
+			nil,
+			nil,
+		),
+		celsiusToFahrenheit,
+	},
+	"apparent_temp": {
+		prometheus.NewDesc(
+			prometheus.BuildFQName("awair", "", "apparent_temperature_fahrenheit"),
+			"Apparent temperature in still air out of the sun, per the Australian Bureau of Meteorology (ºF)",
+			nil,
+			nil,
+		),
+		celsiusToFahrenheit,
+	},
+	"abs_humid": {
+		prometheus.NewDesc(
+			prometheus.BuildFQName("awair", "", "absolute_humidity_grains_per_cubic_foot"),
+			"Absolute Humidity (gr/ft³)",
+			nil,
+			nil,
+		),
+		func(v float64) float64 { return v * gramsPerCubicMetreInGrains },
+	},
+}
+
+// sensorDesc returns the desc to export s as, and converts its readings to the
+// exporter's unit system.
+func (e *AwairExporter) sensorDesc(s sensor) (*prometheus.Desc, func(float64) float64) {
+	if e.units == UnitsImperial {
+		if c, ok := imperialSensors[s.name]; ok {
+			return c.desc, c.convert
+		}
+	}
+	return s.desc, func(v float64) float64 { return v }
+}